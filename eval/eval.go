@@ -1,30 +1,40 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
+	"os"
 
-	"github.com/tdewolff/parse/v2"
-	"github.com/tdewolff/parse/v2/js"
 	"github.com/zond/gojuice/machine"
 )
 
 func main() {
 	input := flag.String("input", "", "What to run")
 	debug := flag.Bool("debug", false, "Whether to log all evaluations")
+	modulesDir := flag.String("modules-dir", "", "Where to load imported modules from")
 	flag.Parse()
-	ast, err := js.Parse(parse.NewInputString(*input))
+	ast, err := machine.Parse(*input)
 	if err != nil {
-		panic(err)
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
 	}
 	m := machine.New()
 	m.Debug = *debug
+	machine.InstallStdlib(m)
+	if *modulesDir != "" {
+		m.ModuleLoader = machine.FSLoader{Dir: *modulesDir}
+	}
 	m.Globals["out"] = func(params ...interface{}) (interface{}, error) {
+		for idx := range params {
+			params[idx] = machine.Inspect(params[idx])
+		}
 		fmt.Println(params...)
 		return nil, nil
 	}
 	r := m.NewRuntime()
-	if err := r.Run(ast); err != nil {
-		panic(err)
+	if err := r.RunContext(context.Background(), ast); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
 	}
 }
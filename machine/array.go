@@ -0,0 +1,60 @@
+package machine
+
+// Array is a JS array. Arrays are shared by reference and mutated in place, so that all references see the same elements.
+type Array struct {
+	Elems []interface{}
+	// Properties holds named properties, like the index and input of match results.
+	Properties map[string]interface{}
+
+	frozen bool
+}
+
+// importValue wraps slices coming from the host, so that the evaluator only ever sees *Array.
+func importValue(i interface{}) interface{} {
+	if elems, ok := i.([]interface{}); ok {
+		return &Array{Elems: elems}
+	}
+	return i
+}
+
+// Export converts arrays and objects into plain slices and maps, recursively, for hosts that want Go values.
+func Export(i interface{}) interface{} {
+	return export(i, map[interface{}]interface{}{})
+}
+
+func export(i interface{}, seen map[interface{}]interface{}) interface{} {
+	switch v := i.(type) {
+	case *Array:
+		if res, found := seen[v]; found {
+			return res
+		}
+		res := make([]interface{}, len(v.Elems))
+		seen[v] = res
+		for idx, el := range v.Elems {
+			res[idx] = export(el, seen)
+		}
+		return res
+	case *OrderedMap:
+		if res, found := seen[v]; found {
+			return res
+		}
+		res := make(map[string]interface{}, len(v.values))
+		seen[v] = res
+		for k, el := range v.values {
+			res[k] = export(el, seen)
+		}
+		return res
+	case map[string]interface{}:
+		key := collectionKey(v)
+		if res, found := seen[key]; found {
+			return res
+		}
+		res := make(map[string]interface{}, len(v))
+		seen[key] = res
+		for k, el := range v {
+			res[k] = export(el, seen)
+		}
+		return res
+	}
+	return i
+}
@@ -0,0 +1,146 @@
+package machine
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/tdewolff/parse/v2/js"
+)
+
+type UnsettledPromiseError struct {
+	Message string
+	Item    interface{}
+}
+
+func (u UnsettledPromiseError) Error() string {
+	return u.Message
+}
+
+type RejectedPromiseError struct {
+	Message string
+	Item    interface{}
+}
+
+func (r RejectedPromiseError) Error() string {
+	return r.Message
+}
+
+func (r *Runtime) Go(f func() (interface{}, error)) *Promise {
+	res := NewPromise()
+	r.pendingTasks++
+	go func() {
+		val, err := f()
+		r.complete(func() {
+			if err != nil {
+				res.Reject(err)
+			} else {
+				res.Resolve(val)
+			}
+		})
+	}()
+	return res
+}
+
+func (r *Runtime) complete(f func()) {
+	r.completionLock.Lock()
+	r.completions = append(r.completions, f)
+	r.completionLock.Unlock()
+	r.notifyCompletion()
+}
+
+func (r *Runtime) notifyCompletion() {
+	select {
+	case r.completionSignal <- struct{}{}:
+	default:
+	}
+}
+
+func (r *Runtime) runCompletions() {
+	r.completionLock.Lock()
+	completions := r.completions
+	r.completions = nil
+	r.completionLock.Unlock()
+	for _, f := range completions {
+		r.pendingTasks--
+		f()
+	}
+}
+
+func (r *Runtime) waitForCompletion(ctx context.Context) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-r.completionSignal:
+		return nil
+	}
+}
+
+func (r *Runtime) sleep(ctx context.Context, d time.Duration) (bool, error) {
+	if r.pendingTasks == 0 {
+		return false, r.clock().Sleep(ctx, d)
+	}
+	sleepCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		select {
+		case <-r.completionSignal:
+			cancel()
+			r.notifyCompletion()
+		case <-stop:
+		}
+	}()
+	err := r.clock().Sleep(sleepCtx, d)
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return false, ctxErr
+	}
+	return err != nil || sleepCtx.Err() != nil, nil
+}
+
+func (r *Runtime) Await(p *Promise) (interface{}, error) {
+	ctx := r.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if err := r.runUntil(ctx, func() bool {
+		return p.state != pending
+	}); err != nil {
+		return nil, err
+	}
+	if p.state == rejected {
+		if err, ok := p.value.(error); ok {
+			return nil, err
+		}
+		return nil, RejectedPromiseError{
+			Message: fmt.Sprintf("promise rejected with %#v", p.value),
+			Item:    p.value,
+		}
+	}
+	return p.value, nil
+}
+
+func asyncFunction(f Func) Func {
+	return func(args ...interface{}) (interface{}, error) {
+		res := NewPromise()
+		val, err := f(args...)
+		if err != nil {
+			res.Reject(err)
+		} else {
+			res.Resolve(val)
+		}
+		return res, nil
+	}
+}
+
+func (e *Evaluator) EvalAwait(expr *js.UnaryExpr) (interface{}, error) {
+	x, err := e.Eval(expr.X)
+	if err != nil {
+		return nil, err
+	}
+	if p, ok := x.(*Promise); ok {
+		return e.Runtime.Await(p)
+	}
+	return x, nil
+}
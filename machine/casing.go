@@ -0,0 +1,110 @@
+package machine
+
+import (
+	"strings"
+	"unicode"
+)
+
+// specialUpper holds the unconditional uppercase mappings of the Unicode SpecialCasing.txt, which map one rune to
+// several and so are unknown to unicode.ToUpper. The language and context dependent mappings of the file are not
+// applied, so for example a final sigma lowercases to σ rather than ς.
+var specialUpper = map[rune]string{
+	'ß': "SS",
+	'ŉ': "ʼN",
+	'ǰ': "J̌",
+	'ΐ': "Ϊ́",
+	'ΰ': "Ϋ́",
+	'և': "ԵՒ",
+	'ẖ': "H̱",
+	'ẗ': "T̈",
+	'ẘ': "W̊",
+	'ẙ': "Y̊",
+	'ẚ': "Aʾ",
+	'ὐ': "Υ̓",
+	'ὒ': "Υ̓̀",
+	'ὔ': "Υ̓́",
+	'ὖ': "Υ̓͂",
+	'ᾲ': "ᾺΙ",
+	'ᾳ': "ΑΙ",
+	'ᾴ': "ΆΙ",
+	'ᾶ': "Α͂",
+	'ᾷ': "Α͂Ι",
+	'ᾼ': "ΑΙ",
+	'ῂ': "ῊΙ",
+	'ῃ': "ΗΙ",
+	'ῄ': "ΉΙ",
+	'ῆ': "Η͂",
+	'ῇ': "Η͂Ι",
+	'ῌ': "ΗΙ",
+	'ῒ': "Ϊ̀",
+	'ΐ': "Ϊ́",
+	'ῖ': "Ι͂",
+	'ῗ': "Ϊ͂",
+	'ῢ': "Ϋ̀",
+	'ΰ': "Ϋ́",
+	'ῤ': "Ρ̓",
+	'ῦ': "Υ͂",
+	'ῧ': "Ϋ͂",
+	'ῲ': "ῺΙ",
+	'ῳ': "ΩΙ",
+	'ῴ': "ΏΙ",
+	'ῶ': "Ω͂",
+	'ῷ': "Ω͂Ι",
+	'ῼ': "ΩΙ",
+	'ﬀ': "FF",
+	'ﬁ': "FI",
+	'ﬂ': "FL",
+	'ﬃ': "FFI",
+	'ﬄ': "FFL",
+	'ﬅ': "ST",
+	'ﬆ': "ST",
+	'ﬓ': "ՄՆ",
+	'ﬔ': "ՄԵ",
+	'ﬕ': "ՄԻ",
+	'ﬖ': "ՎՆ",
+	'ﬗ': "ՄԽ",
+}
+
+// specialLower is the one unconditional lowercase mapping of SpecialCasing.txt.
+var specialLower = map[rune]string{
+	'İ': "i̇",
+}
+
+func init() {
+	// Greek letters with ypogegrammeni or prosgegrammeni uppercase to the letter without it followed by a capital iota.
+	for _, block := range []struct {
+		from, to rune
+	}{
+		{0x1f80, 0x1f08},
+		{0x1f88, 0x1f08},
+		{0x1f90, 0x1f28},
+		{0x1f98, 0x1f28},
+		{0x1fa0, 0x1f68},
+		{0x1fa8, 0x1f68},
+	} {
+		for offset := rune(0); offset < 8; offset++ {
+			specialUpper[block.from+offset] = string([]rune{block.to + offset, 'Ι'})
+		}
+	}
+}
+
+func mapCase(s string, special map[rune]string, simple func(rune) rune) string {
+	res := &strings.Builder{}
+	res.Grow(len(s))
+	for _, r := range s {
+		if mapped, found := special[r]; found {
+			res.WriteString(mapped)
+		} else {
+			res.WriteRune(simple(r))
+		}
+	}
+	return res.String()
+}
+
+func toUpperCase(s string) string {
+	return mapCase(s, specialUpper, unicode.ToUpper)
+}
+
+func toLowerCase(s string) string {
+	return mapCase(s, specialLower, unicode.ToLower)
+}
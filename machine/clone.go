@@ -0,0 +1,98 @@
+package machine
+
+import (
+	"fmt"
+)
+
+type DataCloneError struct {
+	Message string
+	Item    interface{}
+}
+
+func (d DataCloneError) Error() string {
+	return d.Message
+}
+
+func StructuredClone(r *Runtime, args ...interface{}) (interface{}, error) {
+	var val interface{}
+	if len(args) > 0 {
+		val = args[0]
+	}
+	return r.clone(val, map[interface{}]interface{}{})
+}
+
+// clone keeps track of already cloned values in seen, so that shared references and cycles survive the copy.
+func (r *Runtime) clone(i interface{}, seen map[interface{}]interface{}) (interface{}, error) {
+	switch v := i.(type) {
+	case nil, bool, int, float64, string:
+		return v, nil
+	case *RegExp:
+		return NewRegExp(v.Source, v.Flags)
+	case *Date:
+		return &Date{Time: v.Time}, nil
+	}
+	key := collectionKey(i)
+	if res, found := seen[key]; found {
+		return res, nil
+	}
+	if err := r.ThrottleAllocation(i); err != nil {
+		return nil, err
+	}
+	switch v := i.(type) {
+	case *OrderedMap, map[string]interface{}:
+		obj, _ := asObject(v)
+		res := NewOrderedMap()
+		seen[key] = res
+		for _, k := range obj.Keys() {
+			value, _ := obj.Get(k)
+			el, err := r.clone(value, seen)
+			if err != nil {
+				return nil, err
+			}
+			res.Set(k, el)
+		}
+		return res, nil
+	case *Array:
+		res := &Array{Elems: make([]interface{}, len(v.Elems))}
+		seen[key] = res
+		for idx := range v.Elems {
+			el, err := r.clone(v.Elems[idx], seen)
+			if err != nil {
+				return nil, err
+			}
+			res.Elems[idx] = el
+		}
+		return res, nil
+	case *Set:
+		res := &Set{indices: map[interface{}]int{}}
+		seen[key] = res
+		for _, value := range v.Values() {
+			el, err := r.clone(value, seen)
+			if err != nil {
+				return nil, err
+			}
+			res.Add(el)
+		}
+		return res, nil
+	case *Map:
+		res := &Map{indices: map[interface{}]int{}}
+		seen[key] = res
+		for _, entry := range v.Entries() {
+			pair := entry.(*Array).Elems
+			k, err := r.clone(pair[0], seen)
+			if err != nil {
+				return nil, err
+			}
+			value, err := r.clone(pair[1], seen)
+			if err != nil {
+				return nil, err
+			}
+			res.Set(k, value)
+		}
+		return res, nil
+	}
+	return nil, DataCloneError{
+		Message: fmt.Sprintf("%v could not be cloned", Inspect(i)),
+		Item:    i,
+	}
+}
@@ -0,0 +1,282 @@
+package machine
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+)
+
+type nanKey struct{}
+
+type referenceKey struct {
+	typ     reflect.Type
+	pointer uintptr
+}
+
+func collectionKey(i interface{}) interface{} {
+	if f, ok := i.(float64); ok && math.IsNaN(f) {
+		return nanKey{}
+	}
+	if i == nil || reflect.TypeOf(i).Comparable() {
+		return i
+	}
+	val := reflect.ValueOf(i)
+	switch val.Kind() {
+	case reflect.Map, reflect.Slice, reflect.Func, reflect.Ptr:
+		return referenceKey{typ: val.Type(), pointer: referencePointer(val)}
+	}
+	return fmt.Sprintf("%#v", i)
+}
+
+type Set struct {
+	values  []interface{}
+	indices map[interface{}]int
+}
+
+func NewSet(r *Runtime, args ...interface{}) (interface{}, error) {
+	res := &Set{
+		indices: map[interface{}]int{},
+	}
+	if len(args) > 0 && args[0] != nil {
+		if err := iterate(args[0], func(el interface{}) error {
+			res.Add(el)
+			return nil
+		}); err != nil {
+			return nil, err
+		}
+	}
+	if err := r.ThrottleAllocation(res); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+func (s *Set) Add(value interface{}) {
+	key := collectionKey(value)
+	if _, found := s.indices[key]; found {
+		return
+	}
+	s.indices[key] = len(s.values)
+	s.values = append(s.values, value)
+}
+
+func (s *Set) Has(value interface{}) bool {
+	_, found := s.indices[collectionKey(value)]
+	return found
+}
+
+func (s *Set) Delete(value interface{}) bool {
+	key := collectionKey(value)
+	idx, found := s.indices[key]
+	if !found {
+		return false
+	}
+	delete(s.indices, key)
+	s.values = append(s.values[:idx], s.values[idx+1:]...)
+	for ; idx < len(s.values); idx++ {
+		s.indices[collectionKey(s.values[idx])] = idx
+	}
+	return true
+}
+
+func (s *Set) Clear() {
+	s.values = nil
+	s.indices = map[interface{}]int{}
+}
+
+func (s *Set) Size() int {
+	return len(s.values)
+}
+
+func (s *Set) Values() []interface{} {
+	return append([]interface{}{}, s.values...)
+}
+
+func (e *Evaluator) setProperty(s *Set, name string) (interface{}, error) {
+	switch name {
+	case "size":
+		return s.Size(), nil
+	case "add":
+		return func(value interface{}) (interface{}, error) {
+			if err := e.Runtime.ThrottleAllocation(value); err != nil {
+				return nil, err
+			}
+			s.Add(value)
+			return s, nil
+		}, nil
+	case "has":
+		return func(value interface{}) (interface{}, error) {
+			return s.Has(value), nil
+		}, nil
+	case "delete":
+		return func(value interface{}) (interface{}, error) {
+			return s.Delete(value), nil
+		}, nil
+	case "clear":
+		return func() (interface{}, error) {
+			s.Clear()
+			return nil, nil
+		}, nil
+	case "forEach":
+		return func(iIterator interface{}) (interface{}, error) {
+			iterator, err := e.AssertJSFunc(iIterator)
+			if err != nil {
+				return nil, err
+			}
+			for _, value := range s.Values() {
+				if _, err := iterator(value, value, s); err != nil {
+					return nil, err
+				}
+			}
+			return nil, nil
+		}, nil
+	}
+	return nil, NotImplementedError{
+		Message: fmt.Sprintf("set method %q not implemented", name),
+		Item:    s,
+	}
+}
+
+type Map struct {
+	keys    []interface{}
+	values  []interface{}
+	indices map[interface{}]int
+}
+
+func NewMap(r *Runtime, args ...interface{}) (interface{}, error) {
+	res := &Map{
+		indices: map[interface{}]int{},
+	}
+	if len(args) > 0 && args[0] != nil {
+		if err := iterate(args[0], func(el interface{}) error {
+			entry, ok := el.(*Array)
+			if !ok {
+				return NotPairError{
+					Message: fmt.Sprintf("%#v isn't a key value pair", el),
+					Item:    el,
+				}
+			}
+			var key, value interface{}
+			if len(entry.Elems) > 0 {
+				key = entry.Elems[0]
+			}
+			if len(entry.Elems) > 1 {
+				value = entry.Elems[1]
+			}
+			res.Set(key, value)
+			return nil
+		}); err != nil {
+			return nil, err
+		}
+	}
+	if err := r.ThrottleAllocation(res); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+func (m *Map) Get(key interface{}) interface{} {
+	if idx, found := m.indices[collectionKey(key)]; found {
+		return m.values[idx]
+	}
+	return nil
+}
+
+func (m *Map) Set(key, value interface{}) {
+	k := collectionKey(key)
+	if idx, found := m.indices[k]; found {
+		m.values[idx] = value
+		return
+	}
+	m.indices[k] = len(m.keys)
+	m.keys = append(m.keys, key)
+	m.values = append(m.values, value)
+}
+
+func (m *Map) Has(key interface{}) bool {
+	_, found := m.indices[collectionKey(key)]
+	return found
+}
+
+func (m *Map) Delete(key interface{}) bool {
+	k := collectionKey(key)
+	idx, found := m.indices[k]
+	if !found {
+		return false
+	}
+	delete(m.indices, k)
+	m.keys = append(m.keys[:idx], m.keys[idx+1:]...)
+	m.values = append(m.values[:idx], m.values[idx+1:]...)
+	for ; idx < len(m.keys); idx++ {
+		m.indices[collectionKey(m.keys[idx])] = idx
+	}
+	return true
+}
+
+func (m *Map) Clear() {
+	m.keys = nil
+	m.values = nil
+	m.indices = map[interface{}]int{}
+}
+
+func (m *Map) Size() int {
+	return len(m.keys)
+}
+
+func (m *Map) Entries() []interface{} {
+	res := make([]interface{}, len(m.keys))
+	for idx := range m.keys {
+		res[idx] = &Array{Elems: []interface{}{m.keys[idx], m.values[idx]}}
+	}
+	return res
+}
+
+func (e *Evaluator) mapProperty(m *Map, name string) (interface{}, error) {
+	switch name {
+	case "size":
+		return m.Size(), nil
+	case "get":
+		return func(key interface{}) (interface{}, error) {
+			return m.Get(key), nil
+		}, nil
+	case "set":
+		return func(key, value interface{}) (interface{}, error) {
+			if err := e.Runtime.ThrottleAllocation(value); err != nil {
+				return nil, err
+			}
+			m.Set(key, value)
+			return m, nil
+		}, nil
+	case "has":
+		return func(key interface{}) (interface{}, error) {
+			return m.Has(key), nil
+		}, nil
+	case "delete":
+		return func(key interface{}) (interface{}, error) {
+			return m.Delete(key), nil
+		}, nil
+	case "clear":
+		return func() (interface{}, error) {
+			m.Clear()
+			return nil, nil
+		}, nil
+	case "forEach":
+		return func(iIterator interface{}) (interface{}, error) {
+			iterator, err := e.AssertJSFunc(iIterator)
+			if err != nil {
+				return nil, err
+			}
+			for _, iEntry := range m.Entries() {
+				entry := iEntry.(*Array).Elems
+				if _, err := iterator(entry[1], entry[0], m); err != nil {
+					return nil, err
+				}
+			}
+			return nil, nil
+		}, nil
+	}
+	return nil, NotImplementedError{
+		Message: fmt.Sprintf("map method %q not implemented", name),
+		Item:    m,
+	}
+}
@@ -0,0 +1,113 @@
+package machine
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+type InvalidDateError struct {
+	Message string
+	Item    interface{}
+}
+
+func (i InvalidDateError) Error() string {
+	return i.Message
+}
+
+type funcClock func() time.Time
+
+func (f funcClock) Now() time.Time {
+	return f()
+}
+
+func (f funcClock) Sleep(ctx context.Context, d time.Duration) error {
+	return realClock{}.Sleep(ctx, d)
+}
+
+// SetClock makes Date and timers read the time from now. Timers still wait for real, so fake time needs a Clock with its own Sleep.
+func (r *Runtime) SetClock(now func() time.Time) {
+	r.Clock = funcClock(now)
+}
+
+type Date struct {
+	Time time.Time
+}
+
+func millis(t time.Time) int {
+	return int(t.UnixNano() / int64(time.Millisecond))
+}
+
+func fromMillis(ms int) time.Time {
+	return time.Unix(0, int64(ms)*int64(time.Millisecond)).UTC()
+}
+
+func NewDate(r *Runtime, args ...interface{}) (interface{}, error) {
+	if len(args) == 0 {
+		return &Date{Time: r.clock().Now().UTC()}, nil
+	}
+	if len(args) == 1 {
+		switch v := args[0].(type) {
+		case int:
+			return &Date{Time: fromMillis(v)}, nil
+		case float64:
+			return &Date{Time: fromMillis(int(v))}, nil
+		case string:
+			for _, layout := range []string{time.RFC3339Nano, "2006-01-02T15:04:05", "2006-01-02"} {
+				if t, err := time.Parse(layout, v); err == nil {
+					return &Date{Time: t.UTC()}, nil
+				}
+			}
+		case *Date:
+			return &Date{Time: v.Time}, nil
+		}
+		return nil, InvalidDateError{
+			Message: fmt.Sprintf("%#v is not a valid date", args[0]),
+			Item:    args[0],
+		}
+	}
+	fields := []int{0, 0, 1, 0, 0, 0, 0}
+	for idx := range fields {
+		if idx >= len(args) {
+			break
+		}
+		var err error
+		if fields[idx], err = intArg(args, idx, fields[idx]); err != nil {
+			return nil, err
+		}
+	}
+	return &Date{Time: time.Date(fields[0], time.Month(fields[1]+1), fields[2], fields[3], fields[4], fields[5], fields[6]*int(time.Millisecond), time.UTC)}, nil
+}
+
+func (e *Evaluator) dateProperty(d *Date, name string) (interface{}, error) {
+	getter := func(f func(time.Time) int) interface{} {
+		return func() (interface{}, error) {
+			return f(d.Time), nil
+		}
+	}
+	switch name {
+	case "getTime", "valueOf":
+		return getter(millis), nil
+	case "getFullYear":
+		return getter(func(t time.Time) int { return t.Year() }), nil
+	case "getMonth":
+		return getter(func(t time.Time) int { return int(t.Month()) - 1 }), nil
+	case "getDate":
+		return getter(func(t time.Time) int { return t.Day() }), nil
+	case "getDay":
+		return getter(func(t time.Time) int { return int(t.Weekday()) }), nil
+	case "getHours":
+		return getter(func(t time.Time) int { return t.Hour() }), nil
+	case "getMinutes":
+		return getter(func(t time.Time) int { return t.Minute() }), nil
+	case "getSeconds":
+		return getter(func(t time.Time) int { return t.Second() }), nil
+	case "getMilliseconds":
+		return getter(func(t time.Time) int { return t.Nanosecond() / int(time.Millisecond) }), nil
+	case "toISOString", "toJSON":
+		return func() (interface{}, error) {
+			return d.Time.Format("2006-01-02T15:04:05.000Z"), nil
+		}, nil
+	}
+	return nil, nil
+}
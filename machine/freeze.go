@@ -0,0 +1,64 @@
+package machine
+
+import (
+	"fmt"
+	"reflect"
+)
+
+type FrozenObjectError struct {
+	Message string
+	Item    interface{}
+}
+
+func (f FrozenObjectError) Error() string {
+	return f.Message
+}
+
+func identity(i interface{}) (uintptr, bool) {
+	switch i.(type) {
+	case *OrderedMap, map[string]interface{}, *Array:
+		return reflect.ValueOf(i).Pointer(), true
+	}
+	return 0, false
+}
+
+// Freeze marks arrays and script objects as frozen. Plain maps from the host have nowhere to keep the mark, so the runtime tracks them until it is reset.
+func (r *Runtime) Freeze(i interface{}) interface{} {
+	switch v := i.(type) {
+	case *Array:
+		v.frozen = true
+	case *OrderedMap:
+		v.frozen = true
+	case map[string]interface{}:
+		if r.frozenMaps == nil {
+			r.frozenMaps = map[uintptr]map[string]interface{}{}
+		}
+		// Keeping the map in the table stops its address from being reused by an unrelated map.
+		r.frozenMaps[reflect.ValueOf(v).Pointer()] = v
+	}
+	return i
+}
+
+// IsFrozen is true for frozen arrays and objects, and for primitives which can't be mutated anyway.
+func (r *Runtime) IsFrozen(i interface{}) bool {
+	switch v := i.(type) {
+	case *Array:
+		return v.frozen
+	case *OrderedMap:
+		return v.frozen
+	case map[string]interface{}:
+		_, found := r.frozenMaps[reflect.ValueOf(v).Pointer()]
+		return found
+	}
+	return true
+}
+
+func (r *Runtime) checkNotFrozen(i interface{}) error {
+	if _, ok := identity(i); ok && r.IsFrozen(i) {
+		return FrozenObjectError{
+			Message: fmt.Sprintf("%#v is frozen and can't be mutated", i),
+			Item:    i,
+		}
+	}
+	return nil
+}
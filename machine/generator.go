@@ -0,0 +1,196 @@
+package machine
+
+import (
+	"fmt"
+
+	"github.com/tdewolff/parse/v2/js"
+)
+
+type YieldOutsideGeneratorError struct {
+	Message string
+	Item    interface{}
+}
+
+func (y YieldOutsideGeneratorError) Error() string {
+	return y.Message
+}
+
+type generatorReturn struct{}
+
+func (g generatorReturn) Error() string {
+	return "generator returned"
+}
+
+type generatorStep struct {
+	value interface{}
+	done  bool
+	err   error
+}
+
+type generatorResume struct {
+	value interface{}
+	stop  bool
+}
+
+type Generator struct {
+	runtime *Runtime
+	body    func() (interface{}, error)
+	started bool
+	running bool
+	done    bool
+	steps   chan generatorStep
+	resumes chan generatorResume
+}
+
+func generatorFunction(r *Runtime, f Func) Func {
+	return func(args ...interface{}) (interface{}, error) {
+		return &Generator{
+			runtime: r,
+			body: func() (interface{}, error) {
+				return f(args...)
+			},
+			steps:   make(chan generatorStep),
+			resumes: make(chan generatorResume),
+		}, nil
+	}
+}
+
+func (g *Generator) run() {
+	var val interface{}
+	var err error
+	// The body runs on its own goroutine, so panics have to be recovered here to not take down the host.
+	func() {
+		defer recoverInternalError(&err)
+		g.runtime.generator = g
+		val, err = g.body()
+	}()
+	if _, ok := err.(generatorReturn); ok {
+		err = nil
+	}
+	g.steps <- generatorStep{value: val, done: true, err: err}
+}
+
+func (g *Generator) step(resume generatorResume) (interface{}, bool, error) {
+	if g.done {
+		return nil, true, nil
+	}
+	callerScope, callerGenerator, callerDepth, callerCallDepth := g.runtime.Scope, g.runtime.generator, g.runtime.depth, g.runtime.callDepth
+	g.running = true
+	if !g.started {
+		g.started = true
+		g.runtime.suspendedGenerators()[g] = true
+		go g.run()
+	} else {
+		g.resumes <- resume
+	}
+	step := <-g.steps
+	g.running = false
+	g.runtime.Scope, g.runtime.generator, g.runtime.depth, g.runtime.callDepth = callerScope, callerGenerator, callerDepth, callerCallDepth
+	if step.done {
+		g.done = true
+		delete(g.runtime.generators, g)
+	}
+	return step.value, step.done, step.err
+}
+
+func (r *Runtime) suspendedGenerators() map[*Generator]bool {
+	if r.generators == nil {
+		r.generators = map[*Generator]bool{}
+	}
+	return r.generators
+}
+
+// stopGenerators returns from all unfinished generators, so that their goroutines don't wait forever for a next call.
+func (r *Runtime) stopGenerators() {
+	for g := range r.generators {
+		if !g.running {
+			g.Return(nil)
+		}
+	}
+}
+
+func (g *Generator) Next(value interface{}) (interface{}, bool, error) {
+	return g.step(generatorResume{value: value})
+}
+
+func (g *Generator) Return(value interface{}) error {
+	if !g.started {
+		g.done = true
+	}
+	if g.done {
+		return nil
+	}
+	_, _, err := g.step(generatorResume{stop: true})
+	return err
+}
+
+func (g *Generator) yield(value interface{}) (interface{}, error) {
+	generatorScope, generatorDepth, generatorCallDepth := g.runtime.Scope, g.runtime.depth, g.runtime.callDepth
+	g.steps <- generatorStep{value: value}
+	resume := <-g.resumes
+	g.runtime.Scope, g.runtime.generator, g.runtime.depth, g.runtime.callDepth = generatorScope, g, generatorDepth, generatorCallDepth
+	if resume.stop {
+		return nil, generatorReturn{}
+	}
+	return resume.value, nil
+}
+
+func iteratorResult(value interface{}, done bool) *OrderedMap {
+	res := NewOrderedMap()
+	res.Set("value", value)
+	res.Set("done", done)
+	return res
+}
+
+func (e *Evaluator) generatorMethod(g *Generator, name string) (interface{}, error) {
+	switch name {
+	case "next":
+		return func(args ...interface{}) (interface{}, error) {
+			var value interface{}
+			if len(args) > 0 {
+				value = args[0]
+			}
+			val, done, err := g.Next(value)
+			if err != nil {
+				return nil, err
+			}
+			return iteratorResult(val, done), nil
+		}, nil
+	case "return":
+		return func(args ...interface{}) (interface{}, error) {
+			var value interface{}
+			if len(args) > 0 {
+				value = args[0]
+			}
+			if err := g.Return(value); err != nil {
+				return nil, err
+			}
+			return iteratorResult(value, true), nil
+		}, nil
+	}
+	return nil, NotImplementedError{
+		Message: fmt.Sprintf("generator method %q not implemented", name),
+		Item:    g,
+	}
+}
+
+func (e *Evaluator) EvalYieldExpr(expr *js.YieldExpr) (interface{}, error) {
+	g := e.Runtime.generator
+	if g == nil {
+		return nil, YieldOutsideGeneratorError{
+			Message: "yield outside of generator",
+			Item:    expr,
+		}
+	}
+	val, err := e.Eval(expr.X)
+	if err != nil {
+		return nil, err
+	}
+	if !expr.Generator {
+		return g.yield(val)
+	}
+	return nil, iterate(val, func(el interface{}) error {
+		_, err := g.yield(el)
+		return err
+	})
+}
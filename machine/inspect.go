@@ -0,0 +1,110 @@
+package machine
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var identifierPattern = regexp.MustCompile(`^[A-Za-z_$][A-Za-z0-9_$]*$`)
+
+// Inspect renders values in JS-ish syntax for humans, with strings only quoted when nested.
+func Inspect(i interface{}) string {
+	if s, ok := i.(string); ok {
+		return s
+	}
+	res := &strings.Builder{}
+	inspectValue(res, i, map[uintptr]bool{})
+	return res.String()
+}
+
+func inspectValue(w *strings.Builder, i interface{}, seen map[uintptr]bool) {
+	if id, ok := identity(i); ok {
+		if seen[id] {
+			w.WriteString("[Circular]")
+			return
+		}
+		seen[id] = true
+		defer delete(seen, id)
+	}
+	switch v := i.(type) {
+	case nil:
+		w.WriteString("null")
+	case string:
+		w.WriteString(strconv.Quote(v))
+	case int, float64:
+		w.WriteString(FormatNumber(v))
+	case *Array:
+		inspectValue(w, v.Elems, seen)
+	case []interface{}:
+		w.WriteString("[")
+		for idx, el := range v {
+			if idx > 0 {
+				w.WriteString(", ")
+			}
+			inspectValue(w, el, seen)
+		}
+		w.WriteString("]")
+	case *OrderedMap, map[string]interface{}:
+		obj, _ := asObject(v)
+		keys := obj.Keys()
+		if len(keys) == 0 {
+			w.WriteString("{}")
+			return
+		}
+		w.WriteString("{")
+		for idx, key := range keys {
+			if idx > 0 {
+				w.WriteString(", ")
+			}
+			if identifierPattern.MatchString(key) {
+				w.WriteString(key)
+			} else {
+				w.WriteString(strconv.Quote(key))
+			}
+			w.WriteString(": ")
+			value, _ := obj.Get(key)
+			inspectValue(w, value, seen)
+		}
+		w.WriteString("}")
+	case *Set:
+		fmt.Fprintf(w, "Set(%v) {", v.Size())
+		for idx, el := range v.Values() {
+			if idx > 0 {
+				w.WriteString(", ")
+			}
+			inspectValue(w, el, seen)
+		}
+		w.WriteString("}")
+	case *Map:
+		fmt.Fprintf(w, "Map(%v) {", v.Size())
+		for idx, entry := range v.Entries() {
+			if idx > 0 {
+				w.WriteString(", ")
+			}
+			pair := entry.(*Array).Elems
+			inspectValue(w, pair[0], seen)
+			w.WriteString(" => ")
+			inspectValue(w, pair[1], seen)
+		}
+		w.WriteString("}")
+	case *RegExp:
+		w.WriteString(v.String())
+	case *Date:
+		w.WriteString(v.Time.UTC().Format("2006-01-02T15:04:05.000Z"))
+	case *Promise:
+		w.WriteString("Promise {}")
+	case *JSClass:
+		w.WriteString("[class]")
+	case *FuncObject:
+		w.WriteString("[Function]")
+	default:
+		if reflect.ValueOf(i).Kind() == reflect.Func {
+			w.WriteString("[Function]")
+			return
+		}
+		fmt.Fprint(w, i)
+	}
+}
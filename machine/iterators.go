@@ -0,0 +1,205 @@
+package machine
+
+import (
+	"fmt"
+
+	"github.com/tdewolff/parse/v2/js"
+	"github.com/zond/gojuice/scope"
+)
+
+type NotIterableError struct {
+	Message string
+	Item    interface{}
+}
+
+func (n NotIterableError) Error() string {
+	return n.Message
+}
+
+type loopControl struct {
+	stmt *js.BranchStmt
+}
+
+func (l loopControl) Error() string {
+	return fmt.Sprintf("%v outside of loop", l.stmt)
+}
+
+func isBreak(err error) bool {
+	lc, ok := err.(loopControl)
+	return ok && lc.stmt.Type == js.BreakToken
+}
+
+func isContinue(err error) bool {
+	lc, ok := err.(loopControl)
+	return ok && lc.stmt.Type == js.ContinueToken
+}
+
+func (e *Evaluator) EvalBranchStmt(stmt *js.BranchStmt) (interface{}, error) {
+	if stmt.Label != nil {
+		return nil, NotImplementedError{
+			Message: fmt.Sprintf("labelled %v not yet implemented", stmt),
+			Item:    stmt,
+		}
+	}
+	return nil, loopControl{stmt: stmt}
+}
+
+type Iterator struct {
+	next func() (interface{}, bool)
+}
+
+func NewIterator(next func() (interface{}, bool)) *Iterator {
+	return &Iterator{next: next}
+}
+
+func (i *Iterator) Next() (interface{}, bool) {
+	return i.next()
+}
+
+func arrayIterator(v *Array, item func(idx int) interface{}) *Iterator {
+	idx := 0
+	return NewIterator(func() (interface{}, bool) {
+		if idx >= len(v.Elems) {
+			return nil, true
+		}
+		res := item(idx)
+		idx++
+		return res, false
+	})
+}
+
+func (e *Evaluator) iteratorMethod(i *Iterator, name string) (interface{}, error) {
+	switch name {
+	case "next":
+		return func() (interface{}, error) {
+			val, done := i.Next()
+			return iteratorResult(val, done), nil
+		}, nil
+	}
+	return nil, NotImplementedError{
+		Message: fmt.Sprintf("iterator method %q not implemented", name),
+		Item:    i,
+	}
+}
+
+func iterate(val interface{}, f func(interface{}) error) error {
+	switch v := val.(type) {
+	case string:
+		for _, r := range v {
+			if err := f(string(r)); err != nil {
+				return err
+			}
+		}
+		return nil
+	case *Array:
+		for _, el := range v.Elems {
+			if err := f(importValue(el)); err != nil {
+				return err
+			}
+		}
+		return nil
+	case *Set:
+		for _, el := range v.Values() {
+			if err := f(el); err != nil {
+				return err
+			}
+		}
+		return nil
+	case *Map:
+		for _, el := range v.Entries() {
+			if err := f(el); err != nil {
+				return err
+			}
+		}
+		return nil
+	case *Iterator:
+		for {
+			el, done := v.Next()
+			if done {
+				return nil
+			}
+			if err := f(el); err != nil {
+				return err
+			}
+		}
+	case *Generator:
+		for {
+			el, done, err := v.Next(nil)
+			if err != nil {
+				return err
+			}
+			if done {
+				return nil
+			}
+			if err := f(el); err != nil {
+				v.Return(nil)
+				return err
+			}
+		}
+	case *OrderedMap, map[string]interface{}:
+		obj, _ := asObject(v)
+		next, found := obj.Get("next")
+		if !found {
+			break
+		}
+		for {
+			iResult, err := Call(next, nil)
+			if err != nil {
+				return err
+			}
+			result, ok := asObject(iResult)
+			if !ok {
+				return NotObjectError{
+					Message: fmt.Sprintf("iterator result %#v is not an object", iResult),
+					Item:    iResult,
+				}
+			}
+			if done, _ := result.Get("done"); done == true {
+				return nil
+			}
+			value, _ := result.Get("value")
+			if err := f(value); err != nil {
+				return err
+			}
+		}
+	}
+	return NotIterableError{
+		Message: fmt.Sprintf("%#v is not iterable", val),
+		Item:    val,
+	}
+}
+
+func (e *Evaluator) EvalForOfStmt(stmt *js.ForOfStmt) (interface{}, error) {
+	val, err := e.Eval(stmt.Value)
+	if err != nil {
+		return nil, err
+	}
+	init, ok := stmt.Init.(*js.VarDecl)
+	if !ok || len(init.List) != 1 {
+		return nil, NotImplementedError{
+			Message: fmt.Sprintf("init clause of for of statement %#v not yet implemented", stmt),
+			Item:    stmt,
+		}
+	}
+	if err := iterate(val, e.loopBody(init, stmt.Body)); err != nil && !isBreak(err) {
+		return nil, err
+	}
+	return val, nil
+}
+
+func (e *Evaluator) loopBody(init *js.VarDecl, body js.IStmt) func(interface{}) error {
+	return func(el interface{}) error {
+		e.Runtime.Scope = scope.New(e.Runtime.Scope)
+		defer func() {
+			e.Runtime.Scope = e.Runtime.Scope.Parent
+		}()
+		if _, err := e.EvalBindingElement(init.List[0], el, init.TokenType == js.ConstToken); err != nil {
+			return err
+		}
+		_, err := e.Eval(body)
+		if isContinue(err) {
+			return nil
+		}
+		return err
+	}
+}
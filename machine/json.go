@@ -0,0 +1,318 @@
+package machine
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+type JSONSyntaxError struct {
+	Message string
+	Item    interface{}
+	Offset  int64
+}
+
+func (j JSONSyntaxError) Error() string {
+	return j.Message
+}
+
+func JSONParse(r *Runtime, args ...interface{}) (interface{}, error) {
+	var src interface{}
+	if len(args) > 0 {
+		src = args[0]
+	}
+	return r.ParseJSON(ToJSString(src))
+}
+
+// ParseJSON decodes into interpreter values, with numbers following the same int/float rules as literals.
+func (r *Runtime) ParseJSON(s string) (interface{}, error) {
+	dec := json.NewDecoder(strings.NewReader(s))
+	dec.UseNumber()
+	res, err := r.decodeJSON(dec)
+	if err == nil {
+		if _, err = dec.Token(); err == io.EOF {
+			return res, nil
+		} else if err == nil {
+			err = fmt.Errorf("unexpected data after JSON value")
+		}
+	}
+	offset := dec.InputOffset()
+	if serr, ok := err.(*json.SyntaxError); ok {
+		offset = serr.Offset
+	}
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		err = fmt.Errorf("unexpected end of JSON input")
+	}
+	return nil, JSONSyntaxError{
+		Message: fmt.Sprintf("invalid JSON at offset %v: %v", offset, err),
+		Item:    s,
+		Offset:  offset,
+	}
+}
+
+func (r *Runtime) decodeJSON(dec *json.Decoder) (interface{}, error) {
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+	switch v := tok.(type) {
+	case json.Delim:
+		switch v {
+		case '{':
+			res := NewOrderedMap()
+			for dec.More() {
+				keyTok, err := dec.Token()
+				if err != nil {
+					return nil, err
+				}
+				key, ok := keyTok.(string)
+				if !ok {
+					return nil, fmt.Errorf("expected object key, got %v", keyTok)
+				}
+				value, err := r.decodeJSON(dec)
+				if err != nil {
+					return nil, err
+				}
+				res.Set(key, value)
+			}
+			if _, err := dec.Token(); err != nil {
+				return nil, err
+			}
+			return res, r.ThrottleAllocation(res)
+		case '[':
+			res := &Array{Elems: []interface{}{}}
+			for dec.More() {
+				value, err := r.decodeJSON(dec)
+				if err != nil {
+					return nil, err
+				}
+				res.Elems = append(res.Elems, value)
+			}
+			if _, err := dec.Token(); err != nil {
+				return nil, err
+			}
+			return res, r.ThrottleAllocation(res)
+		}
+		return nil, fmt.Errorf("unexpected %v", v)
+	case json.Number:
+		return parseNumberLiteral(string(v))
+	}
+	return tok, nil
+}
+
+type CyclicStructureError struct {
+	Message string
+	Item    interface{}
+}
+
+func (c CyclicStructureError) Error() string {
+	return c.Message
+}
+
+type jsonStringifier struct {
+	runtime  *Runtime
+	replacer interface{}
+	allowed  map[string]bool
+	indent   string
+	stack    map[uintptr]bool
+}
+
+func JSONStringify(r *Runtime, args ...interface{}) (interface{}, error) {
+	s := &jsonStringifier{
+		runtime: r,
+		stack:   map[uintptr]bool{},
+	}
+	var value interface{}
+	if len(args) > 0 {
+		value = args[0]
+	}
+	if len(args) > 1 {
+		switch replacer := args[1].(type) {
+		case *Array:
+			s.allowed = map[string]bool{}
+			for _, key := range replacer.Elems {
+				s.allowed[ToJSString(key)] = true
+			}
+		default:
+			if isCallable(replacer) {
+				s.replacer = replacer
+			}
+		}
+	}
+	if len(args) > 2 {
+		switch indent := args[2].(type) {
+		case int, float64:
+			s.indent = strings.Repeat(" ", clamp(int(toFloat(indent)), 0, 10))
+		case string:
+			s.indent = indent
+			if len(s.indent) > 10 {
+				s.indent = s.indent[:10]
+			}
+		}
+	}
+	res := &strings.Builder{}
+	holder := NewOrderedMap()
+	holder.Set("", value)
+	ok, err := s.write(res, "", value, holder, "")
+	if err != nil || !ok {
+		return nil, err
+	}
+	return res.String(), nil
+}
+
+// StringifyJSON serializes like JSON.stringify(value, null, indent).
+func (r *Runtime) StringifyJSON(value interface{}, indent string) (string, error) {
+	res, err := JSONStringify(r, value, nil, indent)
+	if err != nil || res == nil {
+		return "", err
+	}
+	return res.(string), nil
+}
+
+func quoteJSON(w *strings.Builder, s string) {
+	w.WriteByte('"')
+	for _, r := range s {
+		switch r {
+		case '"':
+			w.WriteString(`\"`)
+		case '\\':
+			w.WriteString(`\\`)
+		case '\n':
+			w.WriteString(`\n`)
+		case '\r':
+			w.WriteString(`\r`)
+		case '\t':
+			w.WriteString(`\t`)
+		case '\b':
+			w.WriteString(`\b`)
+		case '\f':
+			w.WriteString(`\f`)
+		default:
+			if r < 0x20 {
+				fmt.Fprintf(w, `\u%04x`, r)
+			} else {
+				w.WriteRune(r)
+			}
+		}
+	}
+	w.WriteByte('"')
+}
+
+// write returns false when the value has no JSON representation, so that the caller can skip it.
+func (s *jsonStringifier) write(w *strings.Builder, key string, value interface{}, holder interface{}, indent string) (bool, error) {
+	value = importValue(value)
+	if obj, ok := asObject(value); ok {
+		if toJSON, _ := obj.Get("toJSON"); isCallable(toJSON) {
+			var err error
+			if value, err = s.runtime.call(toJSON, []interface{}{key}); err != nil {
+				return false, err
+			}
+		}
+	}
+	if date, ok := value.(*Date); ok {
+		value = date.Time.UTC().Format("2006-01-02T15:04:05.000Z")
+	}
+	if s.replacer != nil {
+		var err error
+		if value, err = s.runtime.call(s.replacer, []interface{}{key, value, holder}); err != nil {
+			return false, err
+		}
+	}
+	switch v := value.(type) {
+	case nil:
+		w.WriteString("null")
+	case bool:
+		w.WriteString(strconv.FormatBool(v))
+	case int:
+		w.WriteString(strconv.Itoa(v))
+	case float64:
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			w.WriteString("null")
+		} else {
+			w.WriteString(FormatNumber(v))
+		}
+	case string:
+		quoteJSON(w, v)
+	case *Array:
+		return true, s.nested(w, v, indent, '[', ']', func(inner string) (bool, error) {
+			for idx, el := range v.Elems {
+				if idx > 0 {
+					w.WriteString(",")
+				}
+				s.newline(w, inner)
+				if ok, err := s.write(w, strconv.Itoa(idx), el, v, inner); err != nil {
+					return false, err
+				} else if !ok {
+					w.WriteString("null")
+				}
+			}
+			return len(v.Elems) > 0, nil
+		})
+	case *OrderedMap, map[string]interface{}:
+		obj, _ := asObject(v)
+		return true, s.nested(w, v, indent, '{', '}', func(inner string) (bool, error) {
+			written := false
+			for _, k := range obj.Keys() {
+				if s.allowed != nil && !s.allowed[k] {
+					continue
+				}
+				el := &strings.Builder{}
+				value, _ := obj.Get(k)
+				if ok, err := s.write(el, k, value, v, inner); err != nil {
+					return false, err
+				} else if !ok {
+					continue
+				}
+				if written {
+					w.WriteString(",")
+				}
+				s.newline(w, inner)
+				quoteJSON(w, k)
+				w.WriteString(":")
+				if s.indent != "" {
+					w.WriteString(" ")
+				}
+				w.WriteString(el.String())
+				written = true
+			}
+			return written, nil
+		})
+	case *Set, *Map:
+		w.WriteString("{}")
+	default:
+		return false, nil
+	}
+	return true, nil
+}
+
+func (s *jsonStringifier) newline(w *strings.Builder, indent string) {
+	if s.indent != "" {
+		w.WriteString("\n")
+		w.WriteString(indent)
+	}
+}
+
+func (s *jsonStringifier) nested(w *strings.Builder, value interface{}, indent string, open, close byte, body func(inner string) (bool, error)) error {
+	id, _ := identity(value)
+	if s.stack[id] {
+		return CyclicStructureError{
+			Message: "converting circular structure to JSON",
+			Item:    value,
+		}
+	}
+	s.stack[id] = true
+	defer delete(s.stack, id)
+	w.WriteByte(open)
+	nonEmpty, err := body(indent + s.indent)
+	if err != nil {
+		return err
+	}
+	if nonEmpty {
+		s.newline(w, indent)
+	}
+	w.WriteByte(close)
+	return nil
+}
@@ -1,17 +1,37 @@
 package machine
 
 import (
+	"context"
 	"fmt"
+	"math"
+	"math/rand"
+	"path/filepath"
 	"reflect"
+	"runtime"
+	"runtime/debug"
+	"sort"
 	"strconv"
-
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+	"unicode/utf16"
+	"unicode/utf8"
+	"unsafe"
+
+	"github.com/tdewolff/parse/v2"
 	"github.com/tdewolff/parse/v2/js"
 	"github.com/zond/gojuice/scope"
 )
 
 var (
-	ifaceType = reflect.TypeOf((*interface{})(nil)).Elem()
-	errorType = reflect.TypeOf((*error)(nil)).Elem()
+	ifaceType       = reflect.TypeOf((*interface{})(nil)).Elem()
+	sliceType       = reflect.TypeOf([]interface{}{})
+	arrayType       = reflect.TypeOf(&Array{})
+	mapType         = reflect.TypeOf(map[string]interface{}{})
+	objectType      = reflect.TypeOf(&OrderedMap{})
+	runtimeFuncType = reflect.TypeOf(RuntimeFunc(nil))
+	errorType       = reflect.TypeOf((*error)(nil)).Elem()
 )
 
 type NotClassError struct {
@@ -32,6 +52,44 @@ func (n NotPairError) Error() string {
 	return n.Message
 }
 
+type InternalError struct {
+	Message string
+	Item    interface{}
+	Stack   string
+}
+
+func (i InternalError) Error() string {
+	return i.Message
+}
+
+type UndefinedMethodError struct {
+	Message string
+	Item    interface{}
+	Name    string
+}
+
+func (u UndefinedMethodError) Error() string {
+	return u.Message
+}
+
+type StackOverflowError struct {
+	Message string
+	Item    interface{}
+}
+
+func (s StackOverflowError) Error() string {
+	return s.Message
+}
+
+type EmptyReduceError struct {
+	Message string
+	Item    interface{}
+}
+
+func (e EmptyReduceError) Error() string {
+	return e.Message
+}
+
 type NotFunctionError struct {
 	Message string
 	Item    interface{}
@@ -101,6 +159,7 @@ func (n NotImplementedError) Error() string {
 type NotCallableError struct {
 	Message string
 	Item    interface{}
+	Callee  string
 }
 
 func (n NotCallableError) Error() string {
@@ -129,6 +188,17 @@ func (w WrongReturnValueError) Error() string {
 	return w.Message
 }
 
+type WrongArgTypeError struct {
+	Message string
+	Item    interface{}
+	Got     reflect.Type
+	Want    reflect.Type
+}
+
+func (w WrongArgTypeError) Error() string {
+	return w.Message
+}
+
 type NoReturnValueError struct {
 	Message string
 	Item    interface{}
@@ -138,31 +208,143 @@ func (n NoReturnValueError) Error() string {
 	return n.Message
 }
 
-type M struct {
-	Runtimes []*Runtime
-	Globals  map[string]interface{}
-	Debug    bool
+type MissingInitializerError struct {
+	Message string
+	Item    interface{}
 }
 
+func (m MissingInitializerError) Error() string {
+	return m.Message
+}
+
+type M struct {
+	Runtimes     []*Runtime
+	Globals      map[string]interface{}
+	ModuleLoader ModuleLoader
+	Types        map[string]reflect.Type
+	Debug        bool
+	Tracer       Tracer
+	LegacyReduce bool
+	MaxCallDepth int
+	Collator     func(a, b string) int
+	// RandSource, when set, backs Math.random in all runtimes that don't have their own source.
+	// Sources from math/rand aren't safe for concurrent use, so runtimes running in parallel need a locked source.
+	RandSource rand.Source
+}
+
+// maxSafeInteger is the largest integer a float64 represents exactly, like Number.MAX_SAFE_INTEGER.
+const maxSafeInteger = 1<<53 - 1
+
+// DefaultMaxCallDepth is well below what it takes to exhaust the Go stack, set M.MaxCallDepth to 0 to disable the limit.
+const DefaultMaxCallDepth = 1000
+
 func New() *M {
 	return &M{
-		Runtimes: nil,
-		Globals:  map[string]interface{}{},
+		Runtimes:     nil,
+		Globals:      map[string]interface{}{},
+		Types:        map[string]reflect.Type{},
+		MaxCallDepth: DefaultMaxCallDepth,
 	}
 }
 
+func (m *M) RegisterType(name string, typ reflect.Type) {
+	m.Types[name] = typ
+}
+
+func (m *M) IsType(i interface{}, name string) (bool, error) {
+	typ, found := m.Types[name]
+	if !found {
+		return false, NotDeclaredError{
+			Message: fmt.Sprintf("type %q is not registered", name),
+			Item:    name,
+		}
+	}
+	if i == nil {
+		return false, nil
+	}
+	refType := reflect.TypeOf(i)
+	// Scripts see arrays and objects as the slices and maps they export to.
+	switch i.(type) {
+	case *Array:
+		refType = sliceType
+	case *OrderedMap:
+		refType = mapType
+	}
+	return refType == typ || (refType.Kind() == reflect.Ptr && refType.Elem() == typ), nil
+}
+
 type Throttler interface {
 	ThrottleAllocation(interface{}) error
 	ThrottleEnterEvaluation(interface{}) error
 	ThrottleExitEvaluation(interface{})
 }
 
+type ResettableThrottler interface {
+	Throttler
+	Reset()
+}
+
+type ArrayGrowth struct {
+	Array  *Array
+	Length int
+}
+
+type StringGrowth struct {
+	String string
+	Length int
+}
+
 type Runtime struct {
 	M         *M
 	Globals   map[string]interface{}
 	Scope     *scope.S
 	Throttler Throttler
+	Clock     Clock
 	Debug     bool
+	Tracer    Tracer
+
+	DebuggerHook func(e *Evaluator, stmt *js.DebuggerStmt) error
+	Step         StepFunc
+
+	AllowedGlobals map[string]bool
+
+	Output []interface{}
+	// Exports holds what top level scripts export, with the default export under DefaultExport.
+	Exports map[string]interface{}
+
+	timers          map[int]*timer
+	nextTimerID     int
+	closed          bool
+	modules         map[string]*module
+	rand            *rand.Rand
+	newThis         *OrderedMap
+	generator       *Generator
+	generators      map[*Generator]bool
+	importedGlobals map[string]importedGlobal
+	frozenMaps      map[uintptr]map[string]interface{}
+	depth           int
+	callDepth       int
+	ctx             context.Context
+
+	pendingTasks     int
+	completionLock   sync.Mutex
+	completions      []func()
+	completionSignal chan struct{}
+}
+
+func (r *Runtime) SetRandSource(source rand.Source) {
+	r.rand = rand.New(source)
+}
+
+func (r *Runtime) Rand() *rand.Rand {
+	if r.rand == nil {
+		if r.M.RandSource != nil {
+			r.SetRandSource(r.M.RandSource)
+		} else {
+			r.SetRandSource(rand.NewSource(time.Now().UnixNano()))
+		}
+	}
+	return r.rand
 }
 
 func (r *Runtime) ThrottleAllocation(i interface{}) error {
@@ -190,22 +372,51 @@ func (m *M) NewRuntime() *Runtime {
 		M:       m,
 		Globals: map[string]interface{}{},
 		Scope:   scope.New(nil),
+
+		completionSignal: make(chan struct{}, 1),
 	}
+	r.installTimers()
 	m.Runtimes = append(m.Runtimes, r)
 	return r
 }
 
-func (r *Runtime) Lookup(name string) (interface{}, error) {
-	for scope := r.Scope; scope != nil; scope = scope.Parent {
-		if binding := scope.Get(name); binding != nil {
-			return binding.Item, nil
+func (m *M) NewSandboxedRuntime(allowed ...string) *Runtime {
+	r := m.NewRuntime()
+	r.AllowedGlobals = map[string]bool{}
+	for _, name := range allowed {
+		r.AllowedGlobals[name] = true
+	}
+	for name := range r.Globals {
+		if !r.AllowedGlobals[name] {
+			delete(r.Globals, name)
 		}
 	}
+	return r
+}
+
+func (r *Runtime) Reset() {
+	r.stopGenerators()
+	r.Scope = scope.New(nil)
+	r.timers = nil
+	r.modules = nil
+	r.importedGlobals = nil
+	r.frozenMaps = nil
+	r.Output = nil
+	r.Exports = nil
+	if throttler, ok := r.Throttler.(ResettableThrottler); ok {
+		throttler.Reset()
+	}
+}
+
+func (r *Runtime) Lookup(name string) (interface{}, error) {
+	if binding := r.Scope.Lookup(name); binding != nil {
+		return binding.Item, nil
+	}
 	if item, found := r.Globals[name]; found {
-		return item, nil
+		return r.importGlobal(name, item), nil
 	}
-	if item, found := r.M.Globals[name]; found {
-		return item, nil
+	if item, found := r.M.Globals[name]; found && (r.AllowedGlobals == nil || r.AllowedGlobals[name]) {
+		return r.importGlobal(name, item), nil
 	}
 	return nil, NotDeclaredError{
 		Message: fmt.Sprintf("%q is not declared", name),
@@ -213,21 +424,223 @@ func (r *Runtime) Lookup(name string) (interface{}, error) {
 	}
 }
 
+type importedGlobal struct {
+	elems  []interface{}
+	object *OrderedMap
+	value  interface{}
+}
+
+// importGlobal copies slices and objects in the globals into values owned by the runtime, so that scripts can mutate them without touching what the host (and other runtimes) see.
+func (r *Runtime) importGlobal(name string, item interface{}) interface{} {
+	imported, found := r.importedGlobals[name]
+	switch v := item.(type) {
+	case []interface{}:
+		if found && len(imported.elems) == len(v) && (len(v) == 0 || &imported.elems[0] == &v[0]) {
+			return imported.value
+		}
+		imported = importedGlobal{elems: v, value: &Array{Elems: append([]interface{}{}, v...)}}
+	case *OrderedMap:
+		if found && imported.object == v {
+			return imported.value
+		}
+		imported = importedGlobal{object: v, value: v.copy()}
+	default:
+		return item
+	}
+	if r.importedGlobals == nil {
+		r.importedGlobals = map[string]importedGlobal{}
+	}
+	r.importedGlobals[name] = imported
+	return imported.value
+}
+
+// Run evaluates ast. Only ASTs from Parse can use await at the top level, since js.Parse rejects it.
 func (r *Runtime) Run(ast *js.AST) error {
-	evaluator := &Evaluator{Runtime: r}
-	_, err := evaluator.EvalBlockStmt(&ast.BlockStmt, false)
+	_, err := r.runTopLevel(&ast.BlockStmt)
 	return err
 }
 
-func Call(callable interface{}, iArgs []interface{}) (interface{}, error) {
-	args := make([]reflect.Value, len(iArgs))
-	for idx := range args {
-		if iArgs[idx] == nil {
-			args[idx] = reflect.New(ifaceType).Elem()
-		} else {
-			args[idx] = reflect.ValueOf(iArgs[idx])
+func (r *Runtime) runTopLevel(block *js.BlockStmt) (res interface{}, err error) {
+	defer recoverInternalError(&err)
+	mod := &module{
+		namespace: map[string]interface{}{},
+		exports:   map[string]string{},
+	}
+	evaluator := &Evaluator{Runtime: r, topLevel: block, module: mod}
+	if res, err = evaluator.EvalBlockStmt(block, false); err != nil {
+		return nil, err
+	}
+	return res, r.collectExports(mod)
+}
+
+func recoverInternalError(err *error) {
+	if recovered := recover(); recovered != nil {
+		*err = InternalError{
+			Message: fmt.Sprintf("internal error: %v", recovered),
+			Item:    recovered,
+			Stack:   string(debug.Stack()),
+		}
+	}
+}
+
+type Program struct {
+	AST *js.AST
+}
+
+type ParseError struct {
+	Message string
+	Item    interface{}
+	Line    int
+	Column  int
+	Context string
+}
+
+func (p ParseError) Error() string {
+	return p.Message
+}
+
+// Parse parses src as a script. Sources that use await at the top level, which js.Parse rejects, are parsed as the
+// body of an async function, so they have to be parsed with Parse rather than js.Parse to run.
+func Parse(src string) (*js.AST, error) {
+	ast, err := js.Parse(parse.NewInputString(src))
+	if perr, ok := err.(*parse.Error); ok && nearAwait(src, perr) {
+		ast, err = parseAsyncBody(src)
+	}
+	if err != nil {
+		res := ParseError{
+			Message: err.Error(),
+			Item:    err,
 		}
+		if perr, ok := err.(*parse.Error); ok {
+			res.Line, res.Column, res.Context = perr.Position()
+			res.Message = fmt.Sprintf("%s on line %d and column %d", perr.Message, res.Line, res.Column)
+		}
+		return nil, res
+	}
+	finder := &returnFinder{}
+	js.Walk(finder, ast)
+	if finder.found {
+		return nil, ParseError{
+			Message: "return outside of function",
+			Item:    src,
+		}
+	}
+	return ast, nil
+}
+
+const asyncBodyHeader = "async function toplevel() {"
+
+// parseAsyncBody keeps the header on the first line, so that lines are numbered like in src.
+func parseAsyncBody(src string) (*js.AST, error) {
+	ast, err := js.Parse(parse.NewInputString(asyncBodyHeader + src + "\n}"))
+	if err != nil {
+		if perr, ok := err.(*parse.Error); ok {
+			offset := lineOffset(asyncBodyHeader+src, perr.Line, perr.Column) - len(asyncBodyHeader)
+			return nil, parse.NewError(strings.NewReader(src), clamp(offset, 0, len(src)), perr.Message)
+		}
+		return nil, err
+	}
+	if len(ast.BlockStmt.List) == 1 {
+		if decl, ok := ast.BlockStmt.List[0].(*js.FuncDecl); ok {
+			return &js.AST{BlockStmt: decl.Body}, nil
+		}
+	}
+	return nil, fmt.Errorf("%q isn't a valid top level body", src)
+}
+
+// nearAwait tells if the error is at, or just after, an await keyword.
+func nearAwait(src string, perr *parse.Error) bool {
+	offset := lineOffset(src, perr.Line, perr.Column)
+	return strings.HasPrefix(src[offset:], "await") || strings.HasSuffix(strings.TrimRightFunc(src[:offset], unicode.IsSpace), "await")
+}
+
+// lineOffset converts a line and a column counted in runes into a byte offset.
+func lineOffset(src string, line, column int) int {
+	offset := 0
+	for ; line > 1; line-- {
+		next := strings.IndexByte(src[offset:], '\n')
+		if next == -1 {
+			return len(src)
+		}
+		offset += next + 1
+	}
+	for ; column > 1 && offset < len(src); column-- {
+		_, width := utf8.DecodeRuneInString(src[offset:])
+		offset += width
+	}
+	return offset
+}
+
+type returnFinder struct {
+	found bool
+}
+
+func (r *returnFinder) Enter(n js.INode) js.IVisitor {
+	switch n.(type) {
+	case *js.FuncDecl, *js.MethodDecl, *js.ArrowFunc:
+		return nil
+	case *js.ReturnStmt:
+		r.found = true
+		return nil
+	}
+	return r
+}
+
+func (r *returnFinder) Exit(n js.INode) {}
+
+func Compile(src string) (*Program, error) {
+	ast, err := Parse(src)
+	if err != nil {
+		return nil, err
+	}
+	return &Program{AST: ast}, nil
+}
+
+func (r *Runtime) RunProgram(p *Program) (interface{}, error) {
+	return r.runTopLevel(&p.AST.BlockStmt)
+}
+
+func (r *Runtime) RunInteractive(src string) (interface{}, error) {
+	p, err := Compile(src)
+	if err != nil {
+		return nil, err
+	}
+	return r.RunProgram(p)
+}
+
+type CellResult struct {
+	Stmt  js.IStmt
+	Value interface{}
+	Err   error
+}
+
+// RunCells evaluates each top level statement of src separately, so that a failing statement doesn't stop the rest.
+func (r *Runtime) RunCells(src string) ([]CellResult, error) {
+	ast, err := Parse(src)
+	if err != nil {
+		return nil, err
 	}
+	res := make([]CellResult, 0, len(ast.BlockStmt.List))
+	for _, stmt := range ast.BlockStmt.List {
+		cell := CellResult{Stmt: stmt}
+		cell.Value, cell.Err = r.runTopLevel(&js.BlockStmt{List: []js.IStmt{stmt}})
+		res = append(res, cell)
+	}
+	return res, nil
+}
+
+func (r *Runtime) RunContext(ctx context.Context, ast *js.AST) error {
+	r.ctx = ctx
+	defer func() {
+		r.ctx = nil
+	}()
+	if err := r.Run(ast); err != nil {
+		return err
+	}
+	return r.RunLoop(ctx)
+}
+
+func Call(callable interface{}, iArgs []interface{}) (interface{}, error) {
 	refCallable := reflect.ValueOf(callable)
 	if refCallable.Kind() != reflect.Func {
 		return nil, NotCallableError{
@@ -236,14 +649,52 @@ func Call(callable interface{}, iArgs []interface{}) (interface{}, error) {
 		}
 	}
 	refType := reflect.TypeOf(callable)
-	if !refType.IsVariadic() && refType.NumIn() != len(args) {
+	if !refType.IsVariadic() && refType.NumIn() != len(iArgs) {
 		return nil, WrongNumberOfArgsError{
-			Message: fmt.Sprintf("%#v takes %v args, got %v", callable, refType.NumIn(), len(args)),
+			Message: fmt.Sprintf("%#v takes %v args, got %v", callable, refType.NumIn(), len(iArgs)),
 			Item:    callable,
-			Got:     len(args),
+			Got:     len(iArgs),
 			Want:    refType.NumIn(),
 		}
 	}
+	if refType.IsVariadic() && len(iArgs) < refType.NumIn()-1 {
+		return nil, WrongNumberOfArgsError{
+			Message: fmt.Sprintf("%#v takes at least %v args, got %v", callable, refType.NumIn()-1, len(iArgs)),
+			Item:    callable,
+			Got:     len(iArgs),
+			Want:    refType.NumIn() - 1,
+		}
+	}
+	args := make([]reflect.Value, len(iArgs))
+	scriptValues := takesScriptValues(refCallable)
+	for idx := range args {
+		paramType := paramType(refType, idx)
+		if iArgs[idx] == nil {
+			args[idx] = reflect.Zero(paramType)
+			continue
+		}
+		arg := reflect.ValueOf(iArgs[idx])
+		switch {
+		case paramType == ifaceType && !scriptValues:
+			arg = reflect.ValueOf(Export(iArgs[idx]))
+		case arg.Type().AssignableTo(paramType):
+		case paramType == sliceType && arg.Type() == arrayType:
+			arg = reflect.ValueOf(iArgs[idx].(*Array).Elems)
+		case paramType == mapType && arg.Type() == objectType:
+			// The map of an object doesn't know the key order, so hosts get a copy instead.
+			arg = reflect.ValueOf(Export(iArgs[idx]))
+		case isNumberKind(arg.Kind()) && isNumberKind(paramType.Kind()):
+			arg = arg.Convert(paramType)
+		default:
+			return nil, WrongArgTypeError{
+				Message: fmt.Sprintf("%#v can't take %#v as arg %v", callable, iArgs[idx], idx),
+				Item:    callable,
+				Got:     arg.Type(),
+				Want:    paramType,
+			}
+		}
+		args[idx] = arg
+	}
 	if refType.NumOut() != 2 {
 		return nil, NoReturnValueError{
 			Message: fmt.Sprintf("%#v doesn't return exactly two values", callable),
@@ -278,26 +729,120 @@ func Call(callable interface{}, iArgs []interface{}) (interface{}, error) {
 	return res, err
 }
 
+var (
+	packageDir      = sourceDir()
+	scriptFuncLock  sync.RWMutex
+	scriptFuncCache = map[uintptr]bool{}
+)
+
+func sourceDir() string {
+	_, file, _, _ := runtime.Caller(0)
+	return filepath.Dir(file)
+}
+
+// takesScriptValues is true for the funcs of this package, which know about *Array and *OrderedMap, and for
+// RuntimeFuncs, which opt in to them. Other host funcs get plain slices and maps for interface{} params.
+func takesScriptValues(callable reflect.Value) bool {
+	if callable.Type() == runtimeFuncType {
+		return true
+	}
+	pc := callable.Pointer()
+	scriptFuncLock.RLock()
+	res, found := scriptFuncCache[pc]
+	scriptFuncLock.RUnlock()
+	if found {
+		return res
+	}
+	if fn := runtime.FuncForPC(pc); fn != nil {
+		file, _ := fn.FileLine(pc)
+		res = filepath.Dir(file) == packageDir && !strings.HasSuffix(file, "_test.go")
+	}
+	scriptFuncLock.Lock()
+	scriptFuncCache[pc] = res
+	scriptFuncLock.Unlock()
+	return res
+}
+
+func paramType(funcType reflect.Type, idx int) reflect.Type {
+	if funcType.IsVariadic() && idx >= funcType.NumIn()-1 {
+		return funcType.In(funcType.NumIn() - 1).Elem()
+	}
+	return funcType.In(idx)
+}
+
+func isNumberKind(kind reflect.Kind) bool {
+	switch kind {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	}
+	return false
+}
+
+type Func = func(...interface{}) (interface{}, error)
+
+func CallFunc(f interface{}, args ...interface{}) (interface{}, error) {
+	return Call(f, args)
+}
+
+type RuntimeFunc func(r *Runtime, args ...interface{}) (interface{}, error)
+
+type FuncObject struct {
+	Func       interface{}
+	Properties map[string]interface{}
+}
+
 func (r *Runtime) Call(funcName string, args ...interface{}) (interface{}, error) {
 	f, err := r.Lookup(funcName)
 	if err != nil {
 		return nil, err
 	}
-	return Call(f, args)
+	for idx := range args {
+		args[idx] = importValue(args[idx])
+	}
+	res, err := r.call(f, args)
+	return Export(res), err
+}
+
+func isCallable(i interface{}) bool {
+	if _, ok := i.(*FuncObject); ok {
+		return true
+	}
+	return i != nil && reflect.ValueOf(i).Kind() == reflect.Func
+}
+
+func (r *Runtime) call(callable interface{}, args []interface{}) (interface{}, error) {
+	switch f := callable.(type) {
+	case RuntimeFunc:
+		res, err := f(r, args...)
+		return importValue(res), err
+	case *FuncObject:
+		return r.call(f.Func, args)
+	}
+	res, err := Call(callable, args)
+	return importValue(res), err
 }
 
 type Evaluator struct {
 	Runtime *Runtime
+
+	module   *module
+	topLevel *js.BlockStmt
 }
 
 func (e *Evaluator) Eval(i interface{}) (interface{}, error) {
-	if e.Runtime.Debug || e.Runtime.M.Debug {
-		fmt.Printf("Eval(%#v)\n", i)
+	if tracer := e.Runtime.tracer(); tracer != nil {
+		tracer.OnEval(i, e.Runtime.depth)
 	}
 	if err := e.Runtime.ThrottleEnterEvaluation(i); err != nil {
 		return nil, err
 	}
 	defer e.Runtime.ThrottleExitEvaluation(i)
+	e.Runtime.depth++
+	defer func() {
+		e.Runtime.depth--
+	}()
 	if i == nil {
 		return nil, nil
 	}
@@ -320,6 +865,8 @@ func (e *Evaluator) Eval(i interface{}) (interface{}, error) {
 		return e.EvalVar(v)
 	case *js.BinaryExpr:
 		return e.EvalBinaryExpr(v)
+	case *js.UnaryExpr:
+		return e.EvalUnaryExpr(v)
 	case *js.ArrowFunc:
 		return e.EvalArrowFunc(v)
 	case *js.FuncDecl:
@@ -332,12 +879,24 @@ func (e *Evaluator) Eval(i interface{}) (interface{}, error) {
 		return e.EvalDotExpr(v)
 	case *js.ForInStmt:
 		return e.EvalForInStmt(v)
+	case *js.ForOfStmt:
+		return e.EvalForOfStmt(v)
+	case *js.BranchStmt:
+		return e.EvalBranchStmt(v)
+	case *js.YieldExpr:
+		return e.EvalYieldExpr(v)
 	case *js.IndexExpr:
 		return e.EvalIndexExpr(v)
 	case *js.ClassDecl:
 		return e.EvalClassDecl(v)
 	case *js.NewExpr:
 		return e.EvalNewExpr(v)
+	case *js.ImportStmt:
+		return e.EvalImportStmt(v)
+	case *js.ExportStmt:
+		return e.EvalExportStmt(v)
+	case *js.DebuggerStmt:
+		return e.EvalDebuggerStmt(v)
 	}
 	return nil, NotImplementedError{
 		Message: fmt.Sprintf("evaluating %#v not yet implemented", i),
@@ -352,43 +911,54 @@ func (e *Evaluator) EvalNewExpr(expr *js.NewExpr) (interface{}, error) {
 	}
 	switch class := iClass.(type) {
 	case *JSClass:
-		res := map[string]interface{}{}
-		for k, v := range class.Fields {
-			res[k] = v
-		}
-		generateThisFunc := func(body *js.BlockStmt, params js.Params) (func(...interface{}) (interface{}, error), error) {
-			return e.GenerateJSFunction(body, params, map[string]*scope.Binding{
-				"this": &scope.Binding{
-					Item:     res,
-					Constant: true,
-				},
-			})
+		res := NewOrderedMap()
+		constructor, _, err := e.instantiate(class, res)
+		if err != nil {
+			return nil, err
 		}
-		constructor, found := class.Methods["constructor"]
-		if found {
-			constructorF, err := generateThisFunc(&constructor.Body, constructor.Params)
-			if err != nil {
-				return nil, err
-			}
-			args := make([]interface{}, len(expr.Args.List))
-			for idx := range args {
-				args[idx], err = e.Eval(expr.Args.List[idx].Value)
-				if err != nil {
+		if constructor != nil {
+			var args []interface{}
+			if expr.Args != nil {
+				if args, err = e.evalArgs(expr.Args.List); err != nil {
 					return nil, err
 				}
 			}
-			if _, err = Call(constructorF, args); err != nil {
+			if _, err = constructor(args...); err != nil {
 				return nil, err
 			}
 		}
-		for name, method := range class.Methods {
-			methodF, err := generateThisFunc(&method.Body, method.Params)
-			if err != nil {
+		return res, nil
+	case *FuncObject, RuntimeFunc:
+		var args []interface{}
+		if expr.Args != nil {
+			if args, err = e.evalArgs(expr.Args.List); err != nil {
 				return nil, err
 			}
-			res[name] = methodF
 		}
-		return res, nil
+		return e.Runtime.call(class, args)
+	case Func:
+		var args []interface{}
+		if expr.Args != nil {
+			if args, err = e.evalArgs(expr.Args.List); err != nil {
+				return nil, err
+			}
+		}
+		this := NewOrderedMap()
+		e.Runtime.newThis = this
+		res, err := class(args...)
+		// Script functions take newThis when they start, host funcs leave it alone and build their own results.
+		scriptFunc := e.Runtime.newThis != this
+		e.Runtime.newThis = nil
+		if err != nil {
+			return nil, err
+		}
+		if !scriptFunc {
+			return importValue(res), nil
+		}
+		if _, ok := asObject(res); ok {
+			return res, nil
+		}
+		return this, nil
 	}
 	return nil, NotClassError{
 		Message: fmt.Sprintf("%#v is not a class", iClass),
@@ -397,15 +967,90 @@ func (e *Evaluator) EvalNewExpr(expr *js.NewExpr) (interface{}, error) {
 }
 
 type JSClass struct {
-	Fields  map[string]interface{}
+	Super   *JSClass
+	Fields  *OrderedMap
 	Methods map[string]*js.MethodDecl
 }
 
+func (e *Evaluator) instantiate(class *JSClass, this *OrderedMap) (Func, map[string]interface{}, error) {
+	thisScope := map[string]*scope.Binding{
+		"this": &scope.Binding{
+			Item:     this,
+			Constant: true,
+		},
+	}
+	methods := map[string]interface{}{}
+	var constructor Func
+	if class.Super != nil {
+		superConstructor, superMethods, err := e.instantiate(class.Super, this)
+		if err != nil {
+			return nil, nil, err
+		}
+		if superConstructor == nil {
+			superConstructor = func(...interface{}) (interface{}, error) {
+				return nil, nil
+			}
+		}
+		thisScope["super"] = &scope.Binding{
+			Item: &FuncObject{
+				Func:       superConstructor,
+				Properties: superMethods,
+			},
+			Constant: true,
+		}
+		for name, method := range superMethods {
+			methods[name] = method
+		}
+		constructor = superConstructor
+	}
+	for _, k := range class.Fields.keys {
+		this.Set(k, class.Fields.values[k])
+	}
+	names := make([]string, 0, len(class.Methods))
+	for name := range class.Methods {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		method := class.Methods[name]
+		methodF, err := e.GenerateJSFunction(&method.Body, method.Params, thisScope)
+		if err != nil {
+			return nil, nil, err
+		}
+		if method.Async {
+			methodF = asyncFunction(methodF)
+		}
+		if method.Generator {
+			methodF = generatorFunction(e.Runtime, methodF)
+		}
+		if name == "constructor" {
+			constructor = methodF
+		}
+		methods[name] = methodF
+		this.Set(name, methodF)
+	}
+	return constructor, methods, nil
+}
+
 func (e *Evaluator) EvalClassDecl(decl *js.ClassDecl) (interface{}, error) {
 	class := &JSClass{
-		Fields:  map[string]interface{}{},
+		Fields:  NewOrderedMap(),
 		Methods: map[string]*js.MethodDecl{},
 	}
+	if decl.Extends != nil {
+		iSuper, err := e.Eval(decl.Extends)
+		if err != nil {
+			return nil, err
+		}
+		super, ok := iSuper.(*JSClass)
+		if !ok {
+			return nil, NotClassError{
+				Message: fmt.Sprintf("%#v is not a class", iSuper),
+				Item:    iSuper,
+			}
+		}
+		class.Super = super
+	}
 	for _, field := range decl.Definitions {
 		name := string(field.Name.Literal.Data)
 		if field.Name.Computed != nil {
@@ -413,13 +1058,13 @@ func (e *Evaluator) EvalClassDecl(decl *js.ClassDecl) (interface{}, error) {
 			if err != nil {
 				return nil, err
 			}
-			name = fmt.Sprint(iName)
+			name = propertyKey(iName)
 		}
 		val, err := e.Eval(field.Init)
 		if err != nil {
 			return nil, err
 		}
-		class.Fields[name] = val
+		class.Fields.Set(name, val)
 	}
 	for _, method := range decl.Methods {
 		name := string(method.Name.Literal.Data)
@@ -428,15 +1073,25 @@ func (e *Evaluator) EvalClassDecl(decl *js.ClassDecl) (interface{}, error) {
 			if err != nil {
 				return nil, err
 			}
-			name = fmt.Sprint(iName)
+			name = propertyKey(iName)
 		}
 		class.Methods[name] = method
 	}
+	if decl.Name == nil {
+		return class, nil
+	}
 	return class, e.Runtime.Scope.Set(string(decl.Name.Data), &scope.Binding{
 		Item: class,
 	})
 }
 
+func (e *Evaluator) EvalDebuggerStmt(stmt *js.DebuggerStmt) (interface{}, error) {
+	if e.Runtime.DebuggerHook == nil {
+		return nil, nil
+	}
+	return nil, e.Runtime.DebuggerHook(e, stmt)
+}
+
 func (e *Evaluator) EvalReturnStmt(stmt *js.ReturnStmt) (interface{}, error) {
 	return e.Eval(stmt.Value)
 }
@@ -450,23 +1105,56 @@ func (e *Evaluator) EvalIndexExpr(expr *js.IndexExpr) (interface{}, error) {
 	if err != nil {
 		return nil, err
 	}
+	return e.index(expr, x, y)
+}
+
+func arrayIndex(i interface{}) interface{} {
+	if s, ok := i.(string); ok {
+		if idx, err := strconv.Atoi(s); err == nil && idx >= 0 && strconv.Itoa(idx) == s {
+			return idx
+		}
+	}
+	return i
+}
+
+func (e *Evaluator) index(expr *js.IndexExpr, x, y interface{}) (interface{}, error) {
 	switch v := x.(type) {
-	case map[string]interface{}:
-		return v[fmt.Sprint(y)], nil
-	case []interface{}:
-		switch idx := y.(type) {
-		case int:
-			if idx < 0 {
-				idx = idx % len(v)
+	case *OrderedMap, map[string]interface{}:
+		obj, _ := asObject(v)
+		val, _ := obj.Get(propertyKey(y))
+		return importValue(val), nil
+	case string:
+		if idx, ok := arrayIndex(y).(int); ok {
+			units := utf16.Encode([]rune(v))
+			if idx < 0 || idx >= len(units) {
+				return nil, nil
 			}
-			if idx > len(v) {
-				return nil, IndexOutOfBoundsError{
-					Message: fmt.Sprintf("can only index within length %v of array, not %v", len(v), idx),
-					Item:    v,
-					Index:   idx,
-				}
+			return string(utf16.Decode(units[idx : idx+1])), nil
+		}
+		if property, found := stringProperties[fmt.Sprint(y)]; found {
+			return property(e, v)
+		}
+		return nil, nil
+	case *Array:
+		switch idx := arrayIndex(y).(type) {
+		case string:
+			if idx == "length" {
+				return len(v.Elems), nil
+			}
+			if val, found := v.Properties[idx]; found {
+				return importValue(val), nil
 			}
-			return v[idx], nil
+			return nil, NonIntegerIndexError{
+				Message: fmt.Sprintf("can only index arrays using integers, not %#v", y),
+				Item:    v,
+				Index:   y,
+			}
+		case int:
+			// Like holes, elements outside the array read as undefined.
+			if idx < 0 || idx >= len(v.Elems) {
+				return nil, nil
+			}
+			return importValue(v.Elems[idx]), nil
 		default:
 			return nil, NonIntegerIndexError{
 				Message: fmt.Sprintf("can only index arrays using integers, not %#v", y),
@@ -488,9 +1176,21 @@ func (e *Evaluator) EvalArrayExpr(expr *js.ArrayExpr) (interface{}, error) {
 		if err != nil {
 			return nil, err
 		}
+		if el.Spread {
+			if err := iterate(v, func(item interface{}) error {
+				if err := e.Runtime.ThrottleAllocation(item); err != nil {
+					return err
+				}
+				res = append(res, item)
+				return nil
+			}); err != nil {
+				return nil, err
+			}
+			continue
+		}
 		res = append(res, v)
 	}
-	return res, nil
+	return &Array{Elems: res}, nil
 }
 
 func (e *Evaluator) EvalForInStmt(stmt *js.ForInStmt) (interface{}, error) {
@@ -506,30 +1206,23 @@ func (e *Evaluator) EvalForInStmt(stmt *js.ForInStmt) (interface{}, error) {
 				Item:    init,
 			}
 		}
-		iterator := func(el interface{}) error {
-			e.Runtime.Scope = scope.New(e.Runtime.Scope)
-			return func() error {
-				defer func() {
-					e.Runtime.Scope = e.Runtime.Scope.Parent
-				}()
-				if _, err := e.EvalBindingElement(init.List[0], el, init.TokenType == js.ConstToken); err != nil {
-					return err
-				}
-				_, err := e.Eval(stmt.Body)
-				return err
-			}()
-		}
+		iterator := e.loopBody(init, stmt.Body)
 		switch v := val.(type) {
-		case map[string]interface{}:
-			for k := range v {
-				if err := iterator(k); err != nil {
+		case *OrderedMap, map[string]interface{}:
+			obj, _ := asObject(v)
+			for _, k := range obj.Keys() {
+				if err := iterator(k); isBreak(err) {
+					break
+				} else if err != nil {
 					return nil, err
 				}
 			}
 			return v, nil
-		case []interface{}:
-			for _, el := range v {
-				if err := iterator(el); err != nil {
+		case *Array:
+			for idx := range v.Elems {
+				if err := iterator(strconv.Itoa(idx)); isBreak(err) {
+					break
+				} else if err != nil {
 					return nil, err
 				}
 			}
@@ -547,8 +1240,8 @@ func (e *Evaluator) EvalForInStmt(stmt *js.ForInStmt) (interface{}, error) {
 	}
 }
 
-func (e *Evaluator) AssertJSFunc(i interface{}) (func(...interface{}) (interface{}, error), error) {
-	f, ok := i.(func(...interface{}) (interface{}, error))
+func (e *Evaluator) AssertJSFunc(i interface{}) (Func, error) {
+	f, ok := i.(Func)
 	if !ok {
 		return nil, NotFunctionError{
 			Message: fmt.Sprintf("%#v isn't a JS function", i),
@@ -563,21 +1256,45 @@ func (e *Evaluator) EvalDotExpr(expr *js.DotExpr) (interface{}, error) {
 	if err != nil {
 		return nil, err
 	}
+	return e.property(x, string(expr.Y.Data))
+}
+
+func (e *Evaluator) property(x interface{}, name string) (interface{}, error) {
 	switch v := x.(type) {
-	case map[string]interface{}:
-		switch string(expr.Y.Data) {
+	case *OrderedMap, map[string]interface{}:
+		obj, _ := asObject(v)
+		switch name {
 		case "reduce":
-			return func(iIterator, sum interface{}) (interface{}, error) {
+			return func(iIterator interface{}, initial ...interface{}) (interface{}, error) {
 				iterator, err := e.AssertJSFunc(iIterator)
 				if err != nil {
 					return nil, err
 				}
-				for key, val := range v {
-					sum, err = iterator(key, val, sum)
+				var sum interface{}
+				hasSum := len(initial) > 0
+				if hasSum {
+					sum = initial[0]
+				}
+				for _, key := range obj.Keys() {
+					val, _ := obj.Get(key)
+					switch {
+					case !hasSum:
+						sum, hasSum = val, true
+					case e.Runtime.M.LegacyReduce:
+						sum, err = iterator(key, val, sum)
+					default:
+						sum, err = iterator(sum, val, key)
+					}
 					if err != nil {
 						return nil, err
 					}
 				}
+				if !hasSum {
+					return nil, EmptyReduceError{
+						Message: "reduce of empty object with no initial value",
+						Item:    v,
+					}
+				}
 				return sum, nil
 			}, nil
 		case "map":
@@ -586,21 +1303,22 @@ func (e *Evaluator) EvalDotExpr(expr *js.DotExpr) (interface{}, error) {
 				if err != nil {
 					return nil, err
 				}
-				res := map[string]interface{}{}
-				for key, val := range v {
-					mapped, err := iterator(key, val)
+				res := NewOrderedMap()
+				for _, key := range obj.Keys() {
+					val, _ := obj.Get(key)
+					mapped, err := iterator(val, key, v)
 					if err != nil {
 						return nil, err
 					}
 					switch ary := mapped.(type) {
-					case []interface{}:
-						if len(ary) != 2 {
+					case *Array:
+						if len(ary.Elems) != 2 {
 							return nil, NotPairError{
 								Message: fmt.Sprintf("%#v isn't a pair of two values", mapped),
 								Item:    mapped,
 							}
 						}
-						res[fmt.Sprint(ary[0])] = ary[1]
+						res.Set(fmt.Sprint(ary.Elems[0]), ary.Elems[1])
 					default:
 						return nil, NotPairError{
 							Message: fmt.Sprintf("%#v isn't a pair of two values", mapped),
@@ -616,31 +1334,56 @@ func (e *Evaluator) EvalDotExpr(expr *js.DotExpr) (interface{}, error) {
 				if err != nil {
 					return nil, err
 				}
-				for key, val := range v {
-					_, err := iterator(key, val)
+				for _, key := range obj.Keys() {
+					val, _ := obj.Get(key)
+					_, err := iterator(val, key, v)
 					if err != nil {
 						return nil, err
 					}
 				}
 				return nil, nil
 			}, nil
+		case "hasOwnProperty":
+			return func(key interface{}) (interface{}, error) {
+				_, found := obj.Get(propertyKey(key))
+				return found, nil
+			}, nil
 		default:
-			return v[string(expr.Y.Data)], nil
+			val, _ := obj.Get(name)
+			return importValue(val), nil
 		}
-	case []interface{}:
-		switch string(expr.Y.Data) {
+	case *Array:
+		switch name {
 		case "reduce":
-			return func(iIterator, sum interface{}) (interface{}, error) {
+			return func(iIterator interface{}, initial ...interface{}) (interface{}, error) {
 				iterator, err := e.AssertJSFunc(iIterator)
 				if err != nil {
 					return nil, err
 				}
-				for _, el := range v {
-					sum, err = iterator(el, sum)
+				var sum interface{}
+				hasSum := len(initial) > 0
+				if hasSum {
+					sum = initial[0]
+				}
+				for idx, el := range v.Elems {
+					switch {
+					case !hasSum:
+						sum, hasSum = el, true
+					case e.Runtime.M.LegacyReduce:
+						sum, err = iterator(el, sum)
+					default:
+						sum, err = iterator(sum, el, idx, v)
+					}
 					if err != nil {
 						return nil, err
 					}
 				}
+				if !hasSum {
+					return nil, EmptyReduceError{
+						Message: "reduce of empty array with no initial value",
+						Item:    v,
+					}
+				}
 				return sum, nil
 			}, nil
 		case "map":
@@ -649,31 +1392,366 @@ func (e *Evaluator) EvalDotExpr(expr *js.DotExpr) (interface{}, error) {
 				if err != nil {
 					return nil, err
 				}
-				res := make([]interface{}, 0, len(v))
-				for _, el := range v {
-					mapped, err := iterator(el)
-					if err != nil {
-						return nil, err
+				res := make([]interface{}, 0, len(v.Elems))
+				for idx, el := range v.Elems {
+					mapped, err := iterator(el, idx, v)
+					if err != nil {
+						return nil, err
+					}
+					res = append(res, mapped)
+				}
+				return &Array{Elems: res}, nil
+			}, nil
+		case "forEach":
+			return func(iIterator interface{}) (interface{}, error) {
+				iterator, err := e.AssertJSFunc(iIterator)
+				if err != nil {
+					return nil, err
+				}
+				for idx, el := range v.Elems {
+					_, err := iterator(el, idx, v)
+					if err != nil {
+						return nil, err
+					}
+				}
+				return nil, nil
+			}, nil
+		case "push":
+			return func(args ...interface{}) (interface{}, error) {
+				if err := e.Runtime.checkNotFrozen(v); err != nil {
+					return nil, err
+				}
+				for _, arg := range args {
+					if err := e.Runtime.ThrottleAllocation(arg); err != nil {
+						return nil, err
+					}
+				}
+				v.Elems = append(v.Elems, args...)
+				return len(v.Elems), nil
+			}, nil
+		case "pop":
+			return func() (interface{}, error) {
+				if err := e.Runtime.checkNotFrozen(v); err != nil {
+					return nil, err
+				}
+				if len(v.Elems) == 0 {
+					return nil, nil
+				}
+				last := v.Elems[len(v.Elems)-1]
+				v.Elems = v.Elems[:len(v.Elems)-1]
+				return last, nil
+			}, nil
+		case "indexOf":
+			return func(args ...interface{}) (interface{}, error) {
+				var search interface{}
+				if len(args) > 0 {
+					search = args[0]
+				}
+				from, err := intArg(args, 1, 0)
+				if err != nil {
+					return nil, err
+				}
+				for idx := relativeIndex(from, len(v.Elems)); idx < len(v.Elems); idx++ {
+					if eq, _ := EqEqEqComparison(v.Elems[idx], search); eq {
+						return idx, nil
+					}
+				}
+				return -1, nil
+			}, nil
+		case "includes":
+			return func(args ...interface{}) (interface{}, error) {
+				var search interface{}
+				if len(args) > 0 {
+					search = args[0]
+				}
+				from, err := intArg(args, 1, 0)
+				if err != nil {
+					return nil, err
+				}
+				for idx := relativeIndex(from, len(v.Elems)); idx < len(v.Elems); idx++ {
+					if eq, _ := SameValueZero(v.Elems[idx], search); eq {
+						return true, nil
+					}
+				}
+				return false, nil
+			}, nil
+		case "join":
+			return func(args ...interface{}) (interface{}, error) {
+				sep := ","
+				if len(args) > 0 && args[0] != nil {
+					sep = fmt.Sprint(args[0])
+				}
+				return Join(v.Elems, sep), nil
+			}, nil
+		case "reverse":
+			return func() (interface{}, error) {
+				if err := e.Runtime.checkNotFrozen(v); err != nil {
+					return nil, err
+				}
+				for i, j := 0, len(v.Elems)-1; i < j; i, j = i+1, j-1 {
+					v.Elems[i], v.Elems[j] = v.Elems[j], v.Elems[i]
+				}
+				return v, nil
+			}, nil
+		case "fill":
+			return func(args ...interface{}) (interface{}, error) {
+				if err := e.Runtime.checkNotFrozen(v); err != nil {
+					return nil, err
+				}
+				var value interface{}
+				if len(args) > 0 {
+					value = args[0]
+				}
+				start, err := intArg(args, 1, 0)
+				if err != nil {
+					return nil, err
+				}
+				end, err := intArg(args, 2, len(v.Elems))
+				if err != nil {
+					return nil, err
+				}
+				for idx := relativeIndex(start, len(v.Elems)); idx < relativeIndex(end, len(v.Elems)); idx++ {
+					v.Elems[idx] = value
+				}
+				return v, nil
+			}, nil
+		case "copyWithin":
+			return func(args ...interface{}) (interface{}, error) {
+				if err := e.Runtime.checkNotFrozen(v); err != nil {
+					return nil, err
+				}
+				target, err := intArg(args, 0, 0)
+				if err != nil {
+					return nil, err
+				}
+				start, err := intArg(args, 1, 0)
+				if err != nil {
+					return nil, err
+				}
+				end, err := intArg(args, 2, len(v.Elems))
+				if err != nil {
+					return nil, err
+				}
+				target, start, end = relativeIndex(target, len(v.Elems)), relativeIndex(start, len(v.Elems)), relativeIndex(end, len(v.Elems))
+				if start < end {
+					copy(v.Elems[target:], v.Elems[start:end])
+				}
+				return v, nil
+			}, nil
+		case "at":
+			return func(args ...interface{}) (interface{}, error) {
+				idx, err := intArg(args, 0, 0)
+				if err != nil {
+					return nil, err
+				}
+				if idx, ok := absoluteIndex(idx, len(v.Elems)); ok {
+					return v.Elems[idx], nil
+				}
+				return nil, nil
+			}, nil
+		case "slice":
+			return func(args ...interface{}) (interface{}, error) {
+				start, end, err := sliceBounds(args, len(v.Elems))
+				if err != nil {
+					return nil, err
+				}
+				res := make([]interface{}, end-start)
+				copy(res, v.Elems[start:end])
+				return &Array{Elems: res}, nil
+			}, nil
+		case "entries":
+			return func() (interface{}, error) {
+				return arrayIterator(v, func(idx int) interface{} {
+					return &Array{Elems: []interface{}{idx, v.Elems[idx]}}
+				}), nil
+			}, nil
+		case "keys":
+			return func() (interface{}, error) {
+				return arrayIterator(v, func(idx int) interface{} {
+					return idx
+				}), nil
+			}, nil
+		case "values":
+			return func() (interface{}, error) {
+				return arrayIterator(v, func(idx int) interface{} {
+					return v.Elems[idx]
+				}), nil
+			}, nil
+		case "toReversed":
+			return func() (interface{}, error) {
+				res := make([]interface{}, len(v.Elems))
+				for idx, el := range v.Elems {
+					res[len(v.Elems)-1-idx] = el
+				}
+				return &Array{Elems: res}, nil
+			}, nil
+		case "filter":
+			return func(iIterator interface{}) (interface{}, error) {
+				iterator, err := e.AssertJSFunc(iIterator)
+				if err != nil {
+					return nil, err
+				}
+				res := []interface{}{}
+				for idx, el := range v.Elems {
+					keep, err := iterator(el, idx)
+					if err != nil {
+						return nil, err
+					}
+					if e.EvalTruth(keep) {
+						res = append(res, el)
+					}
+				}
+				return &Array{Elems: res}, nil
+			}, nil
+		case "find", "findIndex":
+			return func(iPredicate interface{}) (interface{}, error) {
+				predicate, err := e.AssertJSFunc(iPredicate)
+				if err != nil {
+					return nil, err
+				}
+				for idx, el := range v.Elems {
+					found, err := predicate(el, idx)
+					if err != nil {
+						return nil, err
+					}
+					if e.EvalTruth(found) {
+						if name == "find" {
+							return el, nil
+						}
+						return idx, nil
+					}
+				}
+				if name == "find" {
+					return nil, nil
+				}
+				return -1, nil
+			}, nil
+		case "some", "every":
+			return func(iPredicate interface{}) (interface{}, error) {
+				predicate, err := e.AssertJSFunc(iPredicate)
+				if err != nil {
+					return nil, err
+				}
+				every := name == "every"
+				for idx, el := range v.Elems {
+					res, err := predicate(el, idx)
+					if err != nil {
+						return nil, err
+					}
+					if e.EvalTruth(res) != every {
+						return !every, nil
+					}
+				}
+				return every, nil
+			}, nil
+		case "sort":
+			return func(args ...interface{}) (interface{}, error) {
+				if err := e.Runtime.checkNotFrozen(v); err != nil {
+					return nil, err
+				}
+				var compareErr error
+				compare := func(a, b interface{}) int {
+					return compareUnits(utf16.Encode([]rune(ToJSString(a))), utf16.Encode([]rune(ToJSString(b))))
+				}
+				if len(args) > 0 && args[0] != nil {
+					compare = func(a, b interface{}) int {
+						res, err := e.Runtime.call(args[0], []interface{}{a, b})
+						if err != nil && compareErr == nil {
+							compareErr = err
+						}
+						switch n := res.(type) {
+						case int:
+							return n
+						case float64:
+							if n < 0 {
+								return -1
+							} else if n > 0 {
+								return 1
+							}
+						}
+						return 0
 					}
-					res = append(res, mapped)
 				}
-				return res, nil
+				sort.SliceStable(v.Elems, func(i, j int) bool {
+					// Like JS, undefined sorts last without consulting the comparator.
+					if v.Elems[i] == nil || v.Elems[j] == nil {
+						return v.Elems[j] == nil && v.Elems[i] != nil
+					}
+					return compareErr == nil && compare(v.Elems[i], v.Elems[j]) < 0
+				})
+				if compareErr != nil {
+					return nil, compareErr
+				}
+				return v, nil
 			}, nil
-		case "forEach":
-			return func(iIterator interface{}) (interface{}, error) {
-				iterator, err := e.AssertJSFunc(iIterator)
+		case "lastIndexOf":
+			return func(args ...interface{}) (interface{}, error) {
+				var search interface{}
+				if len(args) > 0 {
+					search = args[0]
+				}
+				from, err := intArg(args, 1, len(v.Elems)-1)
 				if err != nil {
 					return nil, err
 				}
-				for _, el := range v {
-					_, err := iterator(el)
-					if err != nil {
-						return nil, err
+				if from < 0 {
+					from += len(v.Elems)
+				} else if from >= len(v.Elems) {
+					from = len(v.Elems) - 1
+				}
+				for idx := from; idx >= 0; idx-- {
+					if eq, _ := EqEqEqComparison(v.Elems[idx], search); eq {
+						return idx, nil
 					}
 				}
-				return nil, nil
+				return -1, nil
 			}, nil
+		case "length":
+			return len(v.Elems), nil
+		case "first":
+			if len(v.Elems) == 0 {
+				return nil, nil
+			}
+			return v.Elems[0], nil
+		case "last":
+			if len(v.Elems) == 0 {
+				return nil, nil
+			}
+			return v.Elems[len(v.Elems)-1], nil
+		}
+		if val, found := v.Properties[name]; found {
+			return importValue(val), nil
 		}
+		return nil, UndefinedMethodError{
+			Message: fmt.Sprintf("method %v not defined on array", name),
+			Item:    v,
+			Name:    name,
+		}
+	case string:
+		if property, found := stringProperties[name]; found {
+			return property(e, v)
+		}
+		return nil, UndefinedMethodError{
+			Message: fmt.Sprintf("method %v not defined on string", name),
+			Item:    v,
+			Name:    name,
+		}
+	case *RegExp:
+		return e.regExpProperty(v, name)
+	case *FuncObject:
+		return importValue(v.Properties[name]), nil
+	case *Date:
+		return e.dateProperty(v, name)
+	case *Promise:
+		return e.promiseMethod(v, name)
+	case *Generator:
+		return e.generatorMethod(v, name)
+	case *Iterator:
+		return e.iteratorMethod(v, name)
+	case *Set:
+		return e.setProperty(v, name)
+	case *Map:
+		return e.mapProperty(v, name)
 	}
 	return nil, NotObjectError{
 		Message: fmt.Sprintf("%#v is not an object", x),
@@ -681,8 +1759,62 @@ func (e *Evaluator) EvalDotExpr(expr *js.DotExpr) (interface{}, error) {
 	}
 }
 
+func intArg(args []interface{}, idx int, def int) (int, error) {
+	if idx >= len(args) {
+		return def, nil
+	}
+	switch v := args[idx].(type) {
+	case nil:
+		return def, nil
+	case int:
+		return v, nil
+	case float64:
+		return int(v), nil
+	}
+	return 0, NonIntegerIndexError{
+		Message: fmt.Sprintf("expected an integer, not %#v", args[idx]),
+		Item:    args,
+		Index:   args[idx],
+	}
+}
+
+func relativeIndex(idx, length int) int {
+	if idx < 0 {
+		idx += length
+		if idx < 0 {
+			return 0
+		}
+	} else if idx > length {
+		return length
+	}
+	return idx
+}
+
+func sliceBounds(args []interface{}, length int) (int, int, error) {
+	start, err := intArg(args, 0, 0)
+	if err != nil {
+		return 0, 0, err
+	}
+	end, err := intArg(args, 1, length)
+	if err != nil {
+		return 0, 0, err
+	}
+	start, end = relativeIndex(start, length), relativeIndex(end, length)
+	if end < start {
+		end = start
+	}
+	return start, end, nil
+}
+
+func absoluteIndex(idx, length int) (int, bool) {
+	if idx < 0 {
+		idx += length
+	}
+	return idx, idx >= 0 && idx < length
+}
+
 func (e *Evaluator) EvalObjectExpr(expr *js.ObjectExpr) (interface{}, error) {
-	res := map[string]interface{}{}
+	res := NewOrderedMap()
 	for _, prop := range expr.List {
 		name := string(prop.Name.Literal.Data)
 		if prop.Name.Computed != nil {
@@ -690,50 +1822,91 @@ func (e *Evaluator) EvalObjectExpr(expr *js.ObjectExpr) (interface{}, error) {
 			if err != nil {
 				return nil, err
 			}
-			name = fmt.Sprint(iName)
+			name = propertyKey(iName)
 		}
 		value, err := e.Eval(prop.Value)
 		if err != nil {
 			return nil, err
 		}
-		res[name] = value
+		res.Set(name, value)
 	}
 	return res, nil
 }
 
 func (e *Evaluator) EvalFuncDecl(f *js.FuncDecl) (interface{}, error) {
-	genF, err := e.GenerateJSFunction(&f.Body, f.Params, nil)
+	if f.Name != nil && f.Name.Decl == js.ExprDecl {
+		self := &scope.Binding{
+			Constant: true,
+		}
+		genF, err := e.generateFunction(&f.Body, f.Params, map[string]*scope.Binding{
+			string(f.Name.Data): self,
+		}, true)
+		if err != nil {
+			return nil, err
+		}
+		if f.Async {
+			genF = asyncFunction(genF)
+		}
+		if f.Generator {
+			genF = generatorFunction(e.Runtime, genF)
+		}
+		self.Item = genF
+		return genF, nil
+	}
+	genF, err := e.generateFunction(&f.Body, f.Params, nil, true)
 	if err != nil {
 		return nil, err
 	}
-	e.Runtime.Scope.Set(string(f.Name.Data), &scope.Binding{
-		Item:     genF,
-		Constant: true,
-	})
+	if f.Async {
+		genF = asyncFunction(genF)
+	}
+	if f.Generator {
+		genF = generatorFunction(e.Runtime, genF)
+	}
+	if f.Name != nil {
+		e.Runtime.Scope.Set(string(f.Name.Data), &scope.Binding{
+			Item:     genF,
+			Constant: true,
+		})
+	}
 	return genF, nil
 }
 
-func (e *Evaluator) GenerateJSFunction(body *js.BlockStmt, expectedParams js.Params, extraScope map[string]*scope.Binding) (func(...interface{}) (interface{}, error), error) {
+func (e *Evaluator) GenerateJSFunction(body *js.BlockStmt, expectedParams js.Params, extraScope map[string]*scope.Binding) (Func, error) {
+	return e.generateFunction(body, expectedParams, extraScope, false)
+}
+
+func (e *Evaluator) generateFunction(body *js.BlockStmt, expectedParams js.Params, extraScope map[string]*scope.Binding, constructor bool) (Func, error) {
 	parentScope := e.Runtime.Scope
 	return func(actualParams ...interface{}) (interface{}, error) {
+		this := e.Runtime.newThis
+		e.Runtime.newThis = nil
+		if max := e.Runtime.M.MaxCallDepth; max > 0 && e.Runtime.callDepth >= max {
+			return nil, StackOverflowError{
+				Message: fmt.Sprintf("maximum call depth %v exceeded", max),
+				Item:    body,
+			}
+		}
+		e.Runtime.callDepth++
+		defer func() {
+			e.Runtime.callDepth--
+		}()
 		currentScope := e.Runtime.Scope
 		e.Runtime.Scope = scope.New(parentScope)
 		defer func() {
 			e.Runtime.Scope = currentScope
 		}()
+		if constructor && this != nil {
+			e.Runtime.Scope.Set("this", &scope.Binding{
+				Item:     this,
+				Constant: true,
+			})
+		}
 		if extraScope != nil {
 			for k, v := range extraScope {
 				e.Runtime.Scope.Set(k, v)
 			}
 		}
-		if len(actualParams) > len(expectedParams.List) {
-			return nil, WrongNumberOfArgsError{
-				Message: fmt.Sprintf("%#v takes %v args, got %v", body, len(expectedParams.List), len(actualParams)),
-				Item:    body,
-				Got:     len(actualParams),
-				Want:    len(expectedParams.List),
-			}
-		}
 		for idx, el := range expectedParams.List {
 			var value interface{}
 			if idx < len(actualParams) {
@@ -748,7 +1921,14 @@ func (e *Evaluator) GenerateJSFunction(body *js.BlockStmt, expectedParams js.Par
 }
 
 func (e *Evaluator) EvalArrowFunc(f *js.ArrowFunc) (interface{}, error) {
-	return e.GenerateJSFunction(&f.Body, f.Params, nil)
+	genF, err := e.GenerateJSFunction(&f.Body, f.Params, nil)
+	if err != nil {
+		return nil, err
+	}
+	if f.Async {
+		return asyncFunction(genF), nil
+	}
+	return genF, nil
 }
 
 func EqEqComparison(x, y interface{}) (bool, error) {
@@ -756,6 +1936,9 @@ func EqEqComparison(x, y interface{}) (bool, error) {
 }
 
 func EqEqEqComparison(x, y interface{}) (bool, error) {
+	if x == nil || y == nil {
+		return x == nil && y == nil, nil
+	}
 	refX := reflect.ValueOf(x)
 	refY := reflect.ValueOf(y)
 	if refX.Kind() != refY.Kind() {
@@ -771,6 +1954,8 @@ func EqEqEqComparison(x, y interface{}) (bool, error) {
 		return refX.Int() == refY.Int(), nil
 	case reflect.Float64:
 		return refX.Float() == refY.Float(), nil
+	case reflect.String:
+		return refX.String() == refY.String(), nil
 	case reflect.Ptr:
 		fallthrough
 	case reflect.Func:
@@ -780,11 +1965,100 @@ func EqEqEqComparison(x, y interface{}) (bool, error) {
 	case reflect.Map:
 		fallthrough
 	case reflect.Slice:
-		return refX.Pointer() == refY.Pointer(), nil
+		return referencePointer(refX) == referencePointer(refY), nil
 	}
 	return reflect.DeepEqual(x, y), nil
 }
 
+// referencePointer identifies reference values. The Pointer of a func is its code, which all closures from the
+// same literal share, so funcs are identified by their closure instead.
+func referencePointer(val reflect.Value) uintptr {
+	if val.Kind() == reflect.Func {
+		if val.IsNil() {
+			return 0
+		}
+		// A func variable holds a pointer to its closure.
+		f := reflect.New(val.Type())
+		f.Elem().Set(val)
+		return *(*uintptr)(unsafe.Pointer(f.Pointer()))
+	}
+	return val.Pointer()
+}
+
+// Relational compares strings by UTF-16 code units and everything else as numbers, so NaN is never ordered.
+func Relational(op js.TokenType, x, y interface{}) (bool, error) {
+	var cmp int
+	xs, xString := x.(string)
+	ys, yString := y.(string)
+	if xString && yString {
+		cmp = compareUnits(utf16.Encode([]rune(xs)), utf16.Encode([]rune(ys)))
+	} else {
+		xf, yf := toFloat(x), toFloat(y)
+		switch {
+		case math.IsNaN(xf) || math.IsNaN(yf):
+			return false, nil
+		case xf < yf:
+			cmp = -1
+		case xf > yf:
+			cmp = 1
+		}
+	}
+	switch op {
+	case js.LtToken:
+		return cmp < 0, nil
+	case js.LtEqToken:
+		return cmp <= 0, nil
+	case js.GtToken:
+		return cmp > 0, nil
+	case js.GtEqToken:
+		return cmp >= 0, nil
+	}
+	return false, BinaryOpNotImplementedError{
+		Message: fmt.Sprintf("relational operator %v not implemented", op),
+		X:       x,
+		Y:       y,
+	}
+}
+
+func compareUnits(x, y []uint16) int {
+	for idx := 0; idx < len(x) && idx < len(y); idx++ {
+		if x[idx] != y[idx] {
+			if x[idx] < y[idx] {
+				return -1
+			}
+			return 1
+		}
+	}
+	return len(x) - len(y)
+}
+
+func Join(v []interface{}, sep string) string {
+	res := &strings.Builder{}
+	for idx, el := range v {
+		if idx > 0 {
+			res.WriteString(sep)
+		}
+		switch elv := el.(type) {
+		case nil:
+		case *Array:
+			res.WriteString(Join(elv.Elems, ","))
+		case []interface{}:
+			res.WriteString(Join(elv, ","))
+		default:
+			res.WriteString(ToJSString(elv))
+		}
+	}
+	return res.String()
+}
+
+func SameValueZero(x, y interface{}) (bool, error) {
+	if xf, ok := x.(float64); ok && math.IsNaN(xf) {
+		yf, ok := y.(float64)
+		return ok && math.IsNaN(yf), nil
+	}
+	return EqEqEqComparison(x, y)
+}
+
 func (e *Evaluator) EvalAssignment(expr *js.BinaryExpr) (interface{}, error) {
 	y, err := e.Eval(expr.Y)
 	if err != nil {
@@ -792,6 +2066,16 @@ func (e *Evaluator) EvalAssignment(expr *js.BinaryExpr) (interface{}, error) {
 	}
 	switch v := expr.X.(type) {
 	case *js.Var:
+		if binding := e.Runtime.Scope.Lookup(string(v.Data)); binding != nil && e.Runtime.Scope.Get(string(v.Data)) == nil {
+			if binding.Constant {
+				return nil, scope.MutatingConstantError{
+					Message: fmt.Sprintf("%q => %#v is constant and can't be mutated", v.Data, binding),
+					Item:    binding,
+				}
+			}
+			binding.Item = y
+			return y, nil
+		}
 		if err := e.Runtime.Scope.Set(string(v.Data), &scope.Binding{
 			Item:     y,
 			Constant: false,
@@ -804,16 +2088,18 @@ func (e *Evaluator) EvalAssignment(expr *js.BinaryExpr) (interface{}, error) {
 		if err != nil {
 			return nil, err
 		}
-		switch hmap := obj.(type) {
-		case map[string]interface{}:
-			hmap[string(v.Y.Data)] = y
-			return y, nil
-		default:
+		if err := e.Runtime.checkNotFrozen(obj); err != nil {
+			return nil, err
+		}
+		target, ok := asObject(obj)
+		if !ok {
 			return nil, NotObjectError{
 				Message: fmt.Sprintf("%#v is not an object", obj),
 				Item:    obj,
 			}
 		}
+		target.Set(string(v.Y.Data), y)
+		return y, nil
 	case *js.IndexExpr:
 		obj, err := e.Eval(v.X)
 		if err != nil {
@@ -823,24 +2109,33 @@ func (e *Evaluator) EvalAssignment(expr *js.BinaryExpr) (interface{}, error) {
 		if err != nil {
 			return nil, err
 		}
+		if err := e.Runtime.checkNotFrozen(obj); err != nil {
+			return nil, err
+		}
 		switch ass := obj.(type) {
-		case map[string]interface{}:
-			ass[fmt.Sprint(idx)] = y
+		case *OrderedMap, map[string]interface{}:
+			target, _ := asObject(ass)
+			target.Set(propertyKey(idx), y)
 			return y, nil
-		case []interface{}:
-			switch i := idx.(type) {
+		case *Array:
+			switch i := arrayIndex(idx).(type) {
 			case int:
 				if i < 0 {
-					i = i % len(ass)
-				}
-				if i+1 > len(ass) {
 					return nil, IndexOutOfBoundsError{
-						Message: fmt.Sprintf("can only index within length %v of array, not %v", len(ass), i),
+						Message: fmt.Sprintf("can only index within length %v of array, not %v", len(ass.Elems), i),
 						Item:    ass,
 						Index:   i,
 					}
 				}
-				ass[i] = y
+				if i >= len(ass.Elems) {
+					if err := e.Runtime.ThrottleAllocation(ArrayGrowth{Array: ass, Length: i + 1}); err != nil {
+						return nil, err
+					}
+					grown := make([]interface{}, i+1)
+					copy(grown, ass.Elems)
+					ass.Elems = grown
+				}
+				ass.Elems[i] = y
 				return y, nil
 			default:
 				return nil, NonIntegerIndexError{
@@ -878,24 +2173,20 @@ func Add(x, y interface{}) (interface{}, error) {
 		case float64:
 			return xv + yv, nil
 		}
-	case string:
-		switch yv := y.(type) {
-		case int:
-			return xv + fmt.Sprint(yv), nil
-		case float64:
-			return xv + fmt.Sprint(yv), nil
-		case string:
-			return xv + fmt.Sprint(yv), nil
-		}
-	case []interface{}:
+	case *Array:
 		switch yv := y.(type) {
-		case []interface{}:
-			res := make([]interface{}, len(xv)+len(yv))
-			copy(res, xv)
-			copy(res[len(xv):], yv)
-			return res, nil
+		case *Array:
+			res := make([]interface{}, len(xv.Elems)+len(yv.Elems))
+			copy(res, xv.Elems)
+			copy(res[len(xv.Elems):], yv.Elems)
+			return &Array{Elems: res}, nil
 		}
 	}
+	_, xString := x.(string)
+	_, yString := y.(string)
+	if xString || yString {
+		return ToJSString(x) + ToJSString(y), nil
+	}
 	return nil, BinaryOpNotImplementedError{
 		Message: fmt.Sprintf("add of %#v and %#v not implemented", x, y),
 		X:       x,
@@ -903,12 +2194,33 @@ func Add(x, y interface{}) (interface{}, error) {
 	}
 }
 
+func Neg(x interface{}) (interface{}, error) {
+	switch xv := x.(type) {
+	case int:
+		return -xv, nil
+	case float64:
+		return -xv, nil
+	}
+	return nil, NotImplementedError{
+		Message: fmt.Sprintf("negation of %#v not implemented", x),
+		Item:    x,
+	}
+}
+
+func BitNot(x interface{}) (interface{}, error) {
+	return int(^ToInt32(x)), nil
+}
+
 func Div(x, y interface{}) (interface{}, error) {
 	switch xv := x.(type) {
 	case int:
 		switch yv := y.(type) {
 		case int:
-			return xv / yv, nil
+			// Only exact quotients stay ints, everything else divides like JS.
+			if yv != 0 && xv%yv == 0 {
+				return xv / yv, nil
+			}
+			return float64(xv) / float64(yv), nil
 		case float64:
 			return float64(xv) / yv, nil
 		}
@@ -970,20 +2282,16 @@ func Mul(x, y interface{}) (interface{}, error) {
 	case string:
 		switch yv := y.(type) {
 		case int:
-			res := ""
-			for i := 0; i < yv; i++ {
-				res += xv
-			}
-			return res, nil
+			return repeatString(xv, yv)
 		}
-	case []interface{}:
+	case *Array:
 		switch yv := y.(type) {
 		case int:
-			res := make([]interface{}, len(xv)*yv)
+			res := make([]interface{}, len(xv.Elems)*yv)
 			for i := 0; i < yv; i++ {
-				copy(res[i*len(xv):], xv)
+				copy(res[i*len(xv.Elems):], xv.Elems)
 			}
-			return res, nil
+			return &Array{Elems: res}, nil
 		}
 	}
 	return nil, BinaryOpNotImplementedError{
@@ -993,6 +2301,25 @@ func Mul(x, y interface{}) (interface{}, error) {
 	}
 }
 
+func In(x, y interface{}) (interface{}, error) {
+	switch yv := y.(type) {
+	case *OrderedMap, map[string]interface{}:
+		obj, _ := asObject(yv)
+		_, found := obj.Get(propertyKey(x))
+		return found, nil
+	case *Array:
+		idx, err := strconv.Atoi(fmt.Sprint(x))
+		if err != nil {
+			return false, nil
+		}
+		return idx >= 0 && idx < len(yv.Elems), nil
+	}
+	return nil, NotObjectError{
+		Message: fmt.Sprintf("can't use 'in' to search for %#v in %#v", x, y),
+		Item:    y,
+	}
+}
+
 func (e *Evaluator) EvalBinaryExpr(expr *js.BinaryExpr) (interface{}, error) {
 	if expr.Op == js.EqToken {
 		return e.EvalAssignment(expr)
@@ -1015,7 +2342,20 @@ func (e *Evaluator) EvalBinaryExpr(expr *js.BinaryExpr) (interface{}, error) {
 	case js.SubToken:
 		return Sub(x, y)
 	case js.MulToken:
+		if xv, ok := x.(string); ok {
+			if yv, ok := y.(int); ok {
+				if err := e.Runtime.throttleRepeat(xv, yv); err != nil {
+					return nil, err
+				}
+			}
+		}
 		return Mul(x, y)
+	case js.DivToken:
+		return Div(x, y)
+	case js.LtToken, js.LtEqToken, js.GtToken, js.GtEqToken:
+		return Relational(expr.Op, x, y)
+	case js.InToken:
+		return In(x, y)
 	}
 	return nil, NotImplementedError{
 		Message: fmt.Sprintf("evaluating binary expression %#v not yet implemented", expr),
@@ -1023,6 +2363,86 @@ func (e *Evaluator) EvalBinaryExpr(expr *js.BinaryExpr) (interface{}, error) {
 	}
 }
 
+func (e *Evaluator) EvalDelete(expr *js.UnaryExpr) (interface{}, error) {
+	var obj, key interface{}
+	var err error
+	switch v := expr.X.(type) {
+	case *js.DotExpr:
+		if obj, err = e.Eval(v.X); err != nil {
+			return nil, err
+		}
+		key = string(v.Y.Data)
+	case *js.IndexExpr:
+		if obj, err = e.Eval(v.X); err != nil {
+			return nil, err
+		}
+		if key, err = e.Eval(v.Y); err != nil {
+			return nil, err
+		}
+	case *js.Var:
+		return false, nil
+	default:
+		if _, err := e.Eval(expr.X); err != nil {
+			return nil, err
+		}
+		return true, nil
+	}
+	if err := e.Runtime.checkNotFrozen(obj); err != nil {
+		return nil, err
+	}
+	switch target := obj.(type) {
+	case *OrderedMap, map[string]interface{}:
+		obj, _ := asObject(target)
+		obj.Delete(propertyKey(key))
+		return true, nil
+	case *Array:
+		if idx, ok := key.(int); ok && idx >= 0 && idx < len(target.Elems) {
+			target.Elems[idx] = nil
+		}
+		return true, nil
+	}
+	return nil, NotObjectError{
+		Message: fmt.Sprintf("%#v is not an object or an array", obj),
+		Item:    obj,
+	}
+}
+
+func (e *Evaluator) EvalUnaryExpr(expr *js.UnaryExpr) (interface{}, error) {
+	switch expr.Op {
+	case js.DeleteToken:
+		return e.EvalDelete(expr)
+	case js.VoidToken:
+		if _, err := e.Eval(expr.X); err != nil {
+			return nil, err
+		}
+		return nil, nil
+	case js.AwaitToken:
+		return e.EvalAwait(expr)
+	case js.NegToken:
+		x, err := e.Eval(expr.X)
+		if err != nil {
+			return nil, err
+		}
+		return Neg(x)
+	case js.PosToken:
+		x, err := e.Eval(expr.X)
+		if err != nil {
+			return nil, err
+		}
+		return ToNumber(x), nil
+	case js.BitNotToken:
+		x, err := e.Eval(expr.X)
+		if err != nil {
+			return nil, err
+		}
+		return BitNot(x)
+	}
+	return nil, NotImplementedError{
+		Message: fmt.Sprintf("evaluating unary expression %#v not yet implemented", expr),
+		Item:    expr,
+	}
+}
+
 func (e *Evaluator) EvalTruth(iVal interface{}) bool {
 	if iVal == nil {
 		return false
@@ -1068,22 +2488,40 @@ func (e *Evaluator) EvalIfStmt(stmt *js.IfStmt) (interface{}, error) {
 	}
 }
 
+func parseNumberLiteral(s string) (interface{}, error) {
+	intVal, err := strconv.Atoi(s)
+	if err != nil {
+		floatVal, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return nil, err
+		}
+		// Exponent literals like 1e3 are integral, so they should be the same number as 1000.
+		if strings.ContainsAny(s, "eE") && floatVal == math.Trunc(floatVal) && math.Abs(floatVal) <= maxSafeInteger {
+			return int(floatVal), nil
+		}
+		return floatVal, nil
+	}
+	return intVal, nil
+}
+
 func (e *Evaluator) EvalLiteralExpr(expr *js.LiteralExpr) (interface{}, error) {
 	switch expr.TokenType {
 	case js.DecimalToken:
-		intVal, err := strconv.Atoi(string(expr.Data))
-		if err != nil {
-			return strconv.ParseFloat(string(expr.Data), 64)
-		}
-		return intVal, nil
+		return parseNumberLiteral(string(expr.Data))
 	case js.StringToken:
 		return string(expr.Data[1 : len(expr.Data)-1]), nil
 	case js.ThisToken:
 		return e.Runtime.Lookup("this")
+	case js.SuperToken:
+		return e.Runtime.Lookup("super")
 	case js.TrueToken:
 		return true, nil
 	case js.FalseToken:
 		return false, nil
+	case js.NullToken:
+		return nil, nil
+	case js.RegExpToken:
+		return ParseRegExpLiteral(string(expr.Data))
 	}
 	return nil, NotImplementedError{
 		Message: fmt.Sprintf("evaluating literal %#v (%v) not yet implemented", expr, expr.TokenType),
@@ -1091,11 +2529,33 @@ func (e *Evaluator) EvalLiteralExpr(expr *js.LiteralExpr) (interface{}, error) {
 	}
 }
 
+func (e *Evaluator) evalArgs(list []js.Arg) ([]interface{}, error) {
+	args := make([]interface{}, len(list))
+	for idx := range args {
+		var err error
+		if args[idx], err = e.Eval(list[idx].Value); err != nil {
+			return nil, err
+		}
+	}
+	return args, nil
+}
+
 func (e *Evaluator) EvalCallExpr(expr *js.CallExpr) (interface{}, error) {
+	if lit, ok := expr.X.(*js.LiteralExpr); ok && lit.TokenType == js.ImportToken {
+		return e.EvalImportCall(expr)
+	}
 	callable, err := e.Eval(expr.X)
 	if err != nil {
 		return nil, err
 	}
+	if !isCallable(callable) {
+		callee := fmt.Sprint(expr.X)
+		return nil, NotCallableError{
+			Message: fmt.Sprintf("%v is %v, not a function", callee, Inspect(callable)),
+			Item:    callable,
+			Callee:  callee,
+		}
+	}
 	args := make([]interface{}, len(expr.Args.List))
 	for idx := range args {
 		args[idx], err = e.Eval(expr.Args.List[idx].Value)
@@ -1103,7 +2563,7 @@ func (e *Evaluator) EvalCallExpr(expr *js.CallExpr) (interface{}, error) {
 			return nil, err
 		}
 	}
-	return Call(callable, args)
+	return e.Runtime.call(callable, args)
 }
 
 func (e *Evaluator) EvalVar(v *js.Var) (interface{}, error) {
@@ -1118,28 +2578,73 @@ func (e *Evaluator) EvalBindingElement(el js.BindingElement, value interface{},
 			return nil, err
 		}
 	}
+	return e.EvalBinding(el.Binding, value, constant)
+}
+
+func (e *Evaluator) EvalBinding(binding js.IBinding, value interface{}, constant bool) (interface{}, error) {
 	if err := e.Runtime.ThrottleAllocation(value); err != nil {
 		return nil, err
 	}
-	switch bind := el.Binding.(type) {
+	switch bind := binding.(type) {
 	case *js.Var:
 		e.Runtime.Scope.Set(string(bind.Data), &scope.Binding{
 			Item:     value,
 			Constant: constant,
 		})
 		return value, nil
+	case *js.BindingArray:
+		ary, ok := value.(*Array)
+		if !ok {
+			return nil, NotIterableError{
+				Message: fmt.Sprintf("can't destructure %#v as an array", value),
+				Item:    value,
+			}
+		}
+		for idx, el := range bind.List {
+			if el.Binding == nil {
+				continue
+			}
+			var item interface{}
+			if idx < len(ary.Elems) {
+				item = ary.Elems[idx]
+			}
+			if _, err := e.EvalBindingElement(el, item, constant); err != nil {
+				return nil, err
+			}
+		}
+		if bind.Rest != nil {
+			rest := &Array{Elems: []interface{}{}}
+			if len(bind.List) < len(ary.Elems) {
+				rest.Elems = append(rest.Elems, ary.Elems[len(bind.List):]...)
+			}
+			if _, err := e.EvalBinding(bind.Rest, rest, constant); err != nil {
+				return nil, err
+			}
+		}
+		return value, nil
 	}
 	return nil, NotImplementedError{
-		Message: fmt.Sprintf("evaluating binding element %#v not yet implemented", el),
-		Item:    el,
+		Message: fmt.Sprintf("evaluating binding %#v not yet implemented", binding),
+		Item:    binding,
 	}
 }
 
 func (e *Evaluator) EvalVarDecl(varDecl *js.VarDecl) (interface{}, error) {
 	var res interface{}
-	var err error
 	for _, el := range varDecl.List {
-		if res, err = e.EvalBindingElement(el, nil, varDecl.TokenType == js.ConstToken); err != nil {
+		// For declarations the parser keeps the initializer where parameters keep
+		// their default, but unlike a default it's evaluated exactly once.
+		if el.Default == nil && varDecl.TokenType == js.ConstToken {
+			return nil, MissingInitializerError{
+				Message: fmt.Sprintf("%v is missing an initializer", el),
+				Item:    el,
+			}
+		}
+		value, err := e.Eval(el.Default)
+		if err != nil {
+			return nil, err
+		}
+		if res, err = e.EvalBinding(el.Binding, value, varDecl.TokenType == js.ConstToken); err != nil {
 			return nil, err
 		}
 	}
@@ -1156,9 +2661,17 @@ func (e *Evaluator) EvalBlockStmt(stmt *js.BlockStmt, newScope bool) (interface{
 	var res interface{}
 	var err error
 	for _, i := range stmt.List {
+		if e.Runtime.Step != nil {
+			if err := e.Runtime.Step(i, e.Runtime.Scope); err != nil {
+				return nil, err
+			}
+		}
 		if res, err = e.Eval(i); err != nil {
 			return nil, err
 		}
+		if _, ok := i.(*js.ExprStmt); ok && stmt == e.topLevel {
+			e.Runtime.Output = append(e.Runtime.Output, res)
+		}
 		switch i.(type) {
 		case *js.ReturnStmt:
 			return res, nil
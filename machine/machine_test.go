@@ -1,8 +1,18 @@
 package machine
 
 import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"math/rand"
+	"os"
+	"path/filepath"
 	"reflect"
+	"runtime"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/tdewolff/parse/v2"
 	"github.com/tdewolff/parse/v2/js"
@@ -34,6 +44,262 @@ func TestRoundtrip(t *testing.T) {
 	}
 }
 
+type fakeClock struct {
+	now time.Time
+}
+
+func (f *fakeClock) Now() time.Time {
+	return f.now
+}
+
+func (f *fakeClock) Sleep(ctx context.Context, d time.Duration) error {
+	f.now = f.now.Add(d)
+	return nil
+}
+
+func TestTimers(t *testing.T) {
+	m := New()
+	resp := []interface{}{}
+	m.Globals["out"] = func(i interface{}) (interface{}, error) {
+		resp = append(resp, i)
+		return nil, nil
+	}
+	ast, err := js.Parse(parse.NewInputString("const c = {\"n\": 0}; const id = setInterval(() => { c.n = c.n + 1; out(c.n); if (c.n === 3) { clearInterval(id); } }, 10); setTimeout(() => { out(\"late\"); }, 100);"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := m.NewRuntime()
+	clock := &fakeClock{now: time.Unix(0, 0)}
+	r.Clock = clock
+	if err = r.Run(ast); err != nil {
+		t.Fatal(err)
+	}
+	if got := r.PendingTimers(); got != 2 {
+		t.Errorf("got %v pending timers, wanted 2", got)
+	}
+	if err = r.RunLoop(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	want := []interface{}{1, 2, 3, "late"}
+	if !reflect.DeepEqual(resp, want) {
+		t.Errorf("got %+v, wanted %+v", resp, want)
+	}
+	if got := clock.now.Sub(time.Unix(0, 0)); got != 100*time.Millisecond {
+		t.Errorf("got %v elapsed, wanted 100ms", got)
+	}
+	if got := r.PendingTimers(); got != 0 {
+		t.Errorf("got %v pending timers, wanted 0", got)
+	}
+	r.Close()
+	if _, err = r.Call("setTimeout", func() (interface{}, error) { return nil, nil }); err == nil {
+		t.Errorf("wanted error scheduling timer on closed runtime")
+	}
+}
+
+func TestZeroInterval(t *testing.T) {
+	r := New().NewRuntime()
+	r.Clock = &fakeClock{now: time.Unix(0, 0)}
+	if _, err := r.RunInteractive("const c = {n: 0}; const id = setInterval(() => { c.n = c.n + 1; }, 0); setTimeout(() => { clearInterval(id); }, 20);"); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.RunLoop(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if res, err := r.RunInteractive("c.n;"); err != nil || res != 5 {
+		t.Errorf("got %v, %v, wanted the interval to fire every 4ms", res, err)
+	}
+}
+
+func TestTimerRuntimeCallbacks(t *testing.T) {
+	r := New().NewRuntime()
+	r.Clock = &fakeClock{now: time.Unix(0, 0)}
+	got := []interface{}{}
+	record := RuntimeFunc(func(rt *Runtime, args ...interface{}) (interface{}, error) {
+		if rt != r {
+			t.Errorf("got runtime %p, wanted %p", rt, r)
+		}
+		got = append(got, args...)
+		return nil, nil
+	})
+	if _, err := r.Call("setTimeout", record, 10, "runtime func"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Call("setTimeout", &FuncObject{Func: record}, 20, "func object"); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.RunLoop(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if want := []interface{}{"runtime func", "func object"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, wanted %v", got, want)
+	}
+}
+
+func TestGeneratorPanic(t *testing.T) {
+	m := New()
+	m.Globals["boom"] = func() (interface{}, error) {
+		panic("boom")
+	}
+	r := m.NewRuntime()
+	_, err := r.RunInteractive("function* g() { yield 1; boom(); } const it = g(); it.next(); it.next();")
+	if _, ok := err.(InternalError); !ok {
+		t.Errorf("got %#v, wanted InternalError", err)
+	}
+}
+
+func TestGeneratorClose(t *testing.T) {
+	before := runtime.NumGoroutine()
+	r := New().NewRuntime()
+	if _, err := r.RunInteractive("function* g() { yield 1; yield 2; } const it = g(); it.next();"); err != nil {
+		t.Fatal(err)
+	}
+	if len(r.generators) != 1 {
+		t.Errorf("got %v suspended generators, wanted 1", len(r.generators))
+	}
+	r.Close()
+	if len(r.generators) != 0 {
+		t.Errorf("got %v suspended generators, wanted 0", len(r.generators))
+	}
+	for deadline := time.Now().Add(time.Second); runtime.NumGoroutine() > before && time.Now().Before(deadline); {
+		time.Sleep(time.Millisecond)
+	}
+	if after := runtime.NumGoroutine(); after > before {
+		t.Errorf("got %v goroutines after Close, wanted %v", after, before)
+	}
+}
+
+func TestRunContext(t *testing.T) {
+	m := New()
+	ctx, cancel := context.WithCancel(context.Background())
+	calls := 0
+	m.Globals["tick"] = func() (interface{}, error) {
+		calls++
+		if calls == 3 {
+			cancel()
+		}
+		return nil, nil
+	}
+	ast, err := js.Parse(parse.NewInputString("setInterval(() => { tick(); }, 10);"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := m.NewRuntime()
+	r.Clock = &fakeClock{now: time.Unix(0, 0)}
+	if err = r.RunContext(ctx, ast); err != context.Canceled {
+		t.Errorf("got %v, wanted %v", err, context.Canceled)
+	}
+	if calls != 3 {
+		t.Errorf("got %v calls, wanted 3", calls)
+	}
+}
+
+func TestAsync(t *testing.T) {
+	m := New()
+	release := make(chan struct{})
+	m.Globals["release"] = func() (interface{}, error) {
+		close(release)
+		return nil, nil
+	}
+	m.Globals["fetch"] = RuntimeFunc(func(r *Runtime, args ...interface{}) (interface{}, error) {
+		url := fmt.Sprint(args[0])
+		return r.Go(func() (interface{}, error) {
+			<-release
+			if url == "bad" {
+				return nil, fmt.Errorf("can't fetch %v", url)
+			}
+			return "body of " + url, nil
+		}), nil
+	})
+	resp := []interface{}{}
+	m.Globals["out"] = func(i interface{}) (interface{}, error) {
+		resp = append(resp, i)
+		return nil, nil
+	}
+	ast, err := js.Parse(parse.NewInputString(`
+async function get(url) {
+  const body = await fetch(url);
+  return body + "!";
+}
+async function main() {
+  setTimeout(() => { release(); }, 1);
+  out(await get("a"));
+  fetch("bad").catch((err) => { out("caught"); });
+  out(await 3);
+}
+main().then((v) => { out("done"); });
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := m.NewRuntime()
+	if err := r.RunContext(context.Background(), ast); err != nil {
+		t.Fatal(err)
+	}
+	if want := []interface{}{"body of a!", 3, "done", "caught"}; !reflect.DeepEqual(resp, want) {
+		t.Errorf("got %#v, wanted %#v", resp, want)
+	}
+}
+
+func TestTopLevelAwait(t *testing.T) {
+	m := New()
+	release := make(chan string)
+	m.Globals["fetch"] = RuntimeFunc(func(r *Runtime, args ...interface{}) (interface{}, error) {
+		url := fmt.Sprint(args[0])
+		return r.Go(func() (interface{}, error) {
+			body := <-release
+			if url == "bad" {
+				return nil, fmt.Errorf("can't fetch %v", url)
+			}
+			return body, nil
+		}), nil
+	})
+	go func() {
+		release <- "body of a"
+		release <- "body of bad"
+	}()
+	r := m.NewRuntime()
+	res, err := r.RunInteractive(`
+const url = "a";
+await fetch(url);
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res != "body of a" {
+		t.Errorf("got %#v, wanted %#v", res, "body of a")
+	}
+	if _, err := r.RunInteractive(`await fetch("bad");`); err == nil || err.Error() != "can't fetch bad" {
+		t.Errorf("got %v, wanted can't fetch bad", err)
+	}
+	if _, err := Parse("await fetch(url"); err == nil {
+		t.Errorf("got no error for broken top level await")
+	} else if _, ok := err.(ParseError); !ok {
+		t.Errorf("got %#v, wanted ParseError", err)
+	}
+	for _, tst := range []struct {
+		src    string
+		line   int
+		column int
+	}{
+		{"return 5;", 0, 0},
+		{"await fetch(url);\nif (url) { return 5; }", 0, 0},
+		{"await fetch(url);\nconst x = ;", 2, 11},
+		{"const x = ;\nawait fetch(url);", 1, 11},
+		{"await (fetch(url);", 1, 18},
+	} {
+		_, err := Parse(tst.src)
+		perr, ok := err.(ParseError)
+		if !ok {
+			t.Errorf("%q: got %#v, wanted ParseError", tst.src, err)
+		} else if perr.Line != tst.line || perr.Column != tst.column {
+			t.Errorf("%q: got line %v and column %v, wanted %v and %v", tst.src, perr.Line, perr.Column, tst.line, tst.column)
+		}
+	}
+	if _, err := Parse("const f = () => { return 1; };\nfunction g() { return 2; }\nawait f();"); err != nil {
+		t.Errorf("got %v, wanted returns in functions to parse", err)
+	}
+}
+
 func TestMisc(t *testing.T) {
 	for _, tst := range []struct {
 		js           string
@@ -133,18 +399,18 @@ func TestMisc(t *testing.T) {
 			wantResp: "z",
 		},
 		{
-			js:           "let a = [3,2,1]; for (let e in a) { out(e); }",
-			wantManyResp: []interface{}{3, 2, 1},
+			js:           "let a = [3,2,1]; for (let e in a) { out(e); out(a[e]); }",
+			wantManyResp: []interface{}{"0", 3, "1", 2, "2", 1},
 		},
 		{
-			js: "const a = {\"x\": 1, \"y\": 2}; const b = {}; a.forEach((k, v) => { b[k] = v; }); out(b);",
+			js: "const a = {\"x\": 1, \"y\": 2}; const b = {}; a.forEach((v, k) => { b[k] = v; }); out(b);",
 			wantResp: map[string]interface{}{
 				"x": 1,
 				"y": 2,
 			},
 		},
 		{
-			js: "const a = {\"x\": 1, \"y\": 2}; out(a.map((k, v) => { return [v, k]; }));",
+			js: "const a = {\"x\": 1, \"y\": 2}; out(a.map((v, k) => { return [v, k]; }));",
 			wantResp: map[string]interface{}{
 				"1": "x",
 				"2": "y",
@@ -175,7 +441,7 @@ func TestMisc(t *testing.T) {
 			wantResp: []interface{}{1, 2, 3, 4},
 		},
 		{
-			js:       "const a = {\"x\": 1, \"y\": 2}; out(a.reduce((k, v, sum) => { return sum + v; }, 0));",
+			js:       "const a = {\"x\": 1, \"y\": 2}; out(a.reduce((sum, v, k) => { return sum + v; }, 0));",
 			wantResp: 3,
 		},
 		{
@@ -187,7 +453,7 @@ func TestMisc(t *testing.T) {
 			wantManyResp: []interface{}{1, 2, 3},
 		},
 		{
-			js:       "let a = [1,2,3]; out(a.reduce((el, sum) => { return sum + el; }, 0));",
+			js:       "let a = [1,2,3]; out(a.reduce((sum, el) => { return sum + el; }, 0));",
 			wantResp: 6,
 		},
 		{
@@ -198,41 +464,2189 @@ func TestMisc(t *testing.T) {
 			js:       "function a(x) { if (x) { return 1; } else { return 2; } }; out(a(true));",
 			wantResp: 1,
 		},
-	} {
-		m := New()
-		resp := []interface{}{}
-		m.Globals["out"] = func(i interface{}) (interface{}, error) {
-			resp = append(resp, i)
-			return nil, nil
-		}
-		ast, err := js.Parse(parse.NewInputString(tst.js))
-		if err != nil {
-			t.Error(err)
-			continue
-		}
-		err = m.NewRuntime().Run(ast)
-		if err != nil && tst.wantErr == nil {
-			t.Errorf("%q produced %v", tst.js, err)
-			continue
-		}
-		if (err == nil && tst.wantErr != nil) || (reflect.TypeOf(tst.wantErr) != reflect.TypeOf(err)) {
-			t.Errorf("%q produced %v, wanted %v", tst.js, err, tst.wantErr)
-			continue
-		}
-		if err == nil {
-			if tst.wantResp != nil {
-				if len(resp) != 1 {
-					t.Errorf("%q produced %v, expected a single value", tst.js, resp)
-				}
-				if !reflect.DeepEqual(resp[0], tst.wantResp) {
-					t.Errorf("%q produced %#v, want single value %#v", tst.js, resp[0], tst.wantResp)
-				}
-			}
-			if tst.wantManyResp != nil {
-				if !reflect.DeepEqual(resp, tst.wantManyResp) {
-					t.Errorf("%q produced %#v, want multi values %#v", tst.js, resp, tst.wantManyResp)
-				}
-			}
-		}
+		{
+			js:       "function f(a, b = a + 1) { return b; }; out(f(2) === 3);",
+			wantResp: true,
+		},
+		{
+			js:       "function f(a, b = a + 1) { return b; }; out(f(2, 5));",
+			wantResp: 5,
+		},
+		{
+			js:       "function fib(n) { if (n === 0) { return 0; } else { if (n === 1) { return 1; } else { return fib(n - 1) + fib(n - 2); } } }; out(fib(10));",
+			wantResp: 55,
+		},
+		{
+			js:       "const f = function fact(n) { if (n === 0) { return 1; } else { return n * fact(n - 1); } }; out(f(5));",
+			wantResp: 120,
+		},
+		{
+			js:      "const f = function g() { return 1; }; g();",
+			wantErr: NotDeclaredError{},
+		},
+		{
+			js:       "const f = function(x) { return x; }; out(f(3));",
+			wantResp: 3,
+		},
+		{
+			js: "const a = {\"x\": 1, \"y\": 1}; const b = Object.assign(a, {\"y\": 2, \"z\": 2}, null, {\"z\": 3}); out(a === b); out(a);",
+			wantManyResp: []interface{}{
+				true,
+				map[string]interface{}{"x": 1, "y": 2, "z": 3},
+			},
+		},
+		{
+			js:      "Object.assign({}, 1);",
+			wantErr: NotObjectError{},
+		},
+		{
+			js:      "Object.assign(1, {});",
+			wantErr: NotObjectError{},
+		},
+		{
+			js:      "const a = Object.freeze({\"x\": 1}); a.x = 2;",
+			wantErr: FrozenObjectError{},
+		},
+		{
+			js:      "const a = Object.freeze({\"x\": 1}); a[\"y\"] = 2;",
+			wantErr: FrozenObjectError{},
+		},
+		{
+			js:      "const a = [1, 2]; Object.freeze(a); a[0] = 2;",
+			wantErr: FrozenObjectError{},
+		},
+		{
+			js:      "const a = Object.freeze({}); Object.assign(a, {\"x\": 1});",
+			wantErr: FrozenObjectError{},
+		},
+		{
+			js:           "const a = {\"x\": {}}; Object.freeze(a); a.x.y = 1; out(a.x.y); out(Object.isFrozen(a)); out(Object.isFrozen(a.x));",
+			wantManyResp: []interface{}{1, true, false},
+		},
+		{
+			js:           "const a = {\"x\": null, 1: 2}; out(\"x\" in a); out(1 in a); out(\"y\" in a);",
+			wantManyResp: []interface{}{true, true, false},
+		},
+		{
+			js:           "const a = [1, 2]; out(0 in a); out(\"1\" in a); out(2 in a); out(\"x\" in a);",
+			wantManyResp: []interface{}{true, true, false, false},
+		},
+		{
+			js:           "const a = {\"x\": null}; out(a.hasOwnProperty(\"x\")); out(a.hasOwnProperty(\"y\"));",
+			wantManyResp: []interface{}{true, false},
+		},
+		{
+			js:      "out(\"x\" in 1);",
+			wantErr: NotObjectError{},
+		},
+		{
+			js:           "const a = [1, 2, 3]; out(a.length); out(a[\"length\"]); out([].length); out(a[a.length - 1]);",
+			wantManyResp: []interface{}{3, 3, 0, 3},
+		},
+		{
+			js:           "const s = \"abc\"; out(s.length); out(s[\"length\"]); out(\"\".length);",
+			wantManyResp: []interface{}{3, 3, 0},
+		},
+		{
+			js:           "const a = {\"x\": 1}; out(a.length); a.length = 2; out(a.length);",
+			wantManyResp: []interface{}{nil, 2},
+		},
+		{
+			js:           "const a = {\"x\": 1, \"y\": 2, \"z\": 3}; out(delete a.x); out(delete a[\"y\"]); out(a);",
+			wantManyResp: []interface{}{true, true, map[string]interface{}{"z": 3}},
+		},
+		{
+			js:           "const a = [1, 2, 3]; out(delete a[1]); out(a); out(a.length);",
+			wantManyResp: []interface{}{true, []interface{}{1, nil, 3}, 3},
+		},
+		{
+			js:      "const a = Object.freeze({\"x\": 1}); delete a.x;",
+			wantErr: FrozenObjectError{},
+		},
+		{
+			js:           "let a = []; out(a.push(1)); out(a.length); out(a.push(2, 3)); out(a);",
+			wantManyResp: []interface{}{1, 1, 3, []interface{}{1, 2, 3}},
+		},
+		{
+			js:           "const a = [1, 2]; out(a.pop()); out(a.pop()); out(a.pop()); out(a.length);",
+			wantManyResp: []interface{}{2, 1, nil, 0},
+		},
+		{
+			js:           "const o = {\"l\": [[]]}; o.l.push(1); o.l[0].push(2); out(o);",
+			wantManyResp: []interface{}{map[string]interface{}{"l": []interface{}{[]interface{}{2}, 1}}},
+		},
+		{
+			js:           "const a = []; function add(x) { a.push(x); }; add(1); add(2); out(a);",
+			wantManyResp: []interface{}{[]interface{}{1, 2}},
+		},
+		{
+			js:      "const a = Object.freeze([1]); a.push(2);",
+			wantErr: FrozenObjectError{},
+		},
+		{
+			js:           "const a = []; out(void 0); out(void a.push(1)); out(a);",
+			wantManyResp: []interface{}{nil, nil, []interface{}{1}},
+		},
+		{
+			js:       "const a = 1, b = a + 1; out(b);",
+			wantResp: 2,
+		},
+		{
+			js:           "function f() { let a = 2, b = a * 3, c = a + b; out(c); }; f();",
+			wantManyResp: []interface{}{8},
+		},
+		{
+			js:           "const a = [1, \"2\", 2.0, 1, {}]; out(a.indexOf(1)); out(a.indexOf(2)); out(a.indexOf(\"2\")); out(a.indexOf(2.0)); out(a.indexOf(a[4])); out(a.indexOf({})); out(a.indexOf(3));",
+			wantManyResp: []interface{}{0, -1, 1, 2, 4, -1, -1},
+		},
+		{
+			js:           "const a = [1, 2, 1, 2]; out(a.indexOf(1, 1)); out(a.indexOf(2, -1)); out(a.indexOf(1, -1)); out(a.indexOf(1, -10)); out(a.indexOf(1, 10));",
+			wantManyResp: []interface{}{2, 3, -1, 0, -1},
+		},
+		{
+			js:           "const a = [1, 2, 1, 2]; out(a.lastIndexOf(1)); out(a.lastIndexOf(2, 2)); out(a.lastIndexOf(2, -2)); out(a.lastIndexOf(1, -10)); out(a.lastIndexOf(3)); out([].lastIndexOf(1));",
+			wantManyResp: []interface{}{2, 1, 1, -1, -1, -1},
+		},
+		{
+			js:           "let a; out(a); a = 1; out(a);",
+			wantManyResp: []interface{}{nil, 1},
+		},
+		{
+			js:      "const a;",
+			wantErr: MissingInitializerError{},
+		},
+		{
+			js:           "const re = /b+/; out(re.test(\"abbc\")); out(re.test(\"ac\")); out(/B/i.test(\"abc\"));",
+			wantManyResp: []interface{}{true, false, true},
+		},
+		{
+			js:           "const re = /(\\w)(\\d)?/g; out(re.exec(\"a1 b\")); out(re.exec(\"a1 b\")); out(re.exec(\"a1 b\")); out(re.exec(\"a1 b\"));",
+			wantManyResp: []interface{}{[]interface{}{"a1", "a", "1"}, []interface{}{"b", "b", nil}, nil, []interface{}{"a1", "a", "1"}},
+		},
+		{
+			js:           "out(\"a1b22\".match(/\\d+/g)); out(\"a1b22\".match(/(\\d)(\\d)/)); out(\"ab\".match(/\\d/)); out(\"a.b\".match(\".\"));",
+			wantManyResp: []interface{}{[]interface{}{"1", "22"}, []interface{}{"22", "2", "2"}, nil, []interface{}{"a"}},
+		},
+		{
+			js:           "out(\"a-b-c\".replace(\"-\", \"+\")); out(\"a-b-c\".replace(/-/g, \"+\")); out(\"john smith\".replace(/(\\w+) (\\w+)/, \"$2, $1 ($&) $$\"));",
+			wantManyResp: []interface{}{"a+b-c", "a+b+c", "smith, john (john smith) $"},
+		},
+		{
+			js:           "out(\"a, b,c\".split(/,\\s*/)); out(\"a,b\".split(\",\")); out(\"ab\".split());",
+			wantManyResp: []interface{}{[]interface{}{"a", "b", "c"}, []interface{}{"a", "b"}, []interface{}{"ab"}},
+		},
+		{
+			js:           "const re = RegExp(\"a+\", \"g\"); out(re.source); out(re.global); out(\"aa\".replace(re, \"b\"));",
+			wantManyResp: []interface{}{"a+", true, "b"},
+		},
+		{
+			js:      "RegExp(\"(\");",
+			wantErr: InvalidRegExpError{},
+		},
+		{
+			js:           "const a = [\"admin\", 2, 3]; out(a.includes(\"admin\")); out(a.includes(\"user\")); out(a.includes(2, 1)); out(a.includes(2, 2)); out(a.includes(3, -1));",
+			wantManyResp: []interface{}{true, false, true, false, true},
+		},
+		{
+			js:           "out(\"admin\".includes(\"dm\")); out(\"admin\".includes(\"x\"));",
+			wantManyResp: []interface{}{true, false},
+		},
+		{
+			js:           "const c = {\"n\": 0}; function f() { c.n = c.n + 1; return null; }; let a = f(); out(c.n);",
+			wantManyResp: []interface{}{1},
+		},
+		{
+			js:           "out([].join(\", \")); out([1].join(\", \")); out([1, \"a\", 2.5].join()); out([1, null, 3].join(\"-\")); out([1, [2, [3, 4]]].join(\";\"));",
+			wantManyResp: []interface{}{"", "1", "1,a,2.5", "1--3", "1;2,3,4"},
+		},
+		{
+			js:           "const a = [1, 2, 3]; const b = a.reverse(); out(a); out(b === a); out([].reverse());",
+			wantManyResp: []interface{}{[]interface{}{3, 2, 1}, true, []interface{}{}},
+		},
+		{
+			js:           "const a = [1, 2, 3]; const b = a.toReversed(); out(a); out(b); out(b === a);",
+			wantManyResp: []interface{}{[]interface{}{1, 2, 3}, []interface{}{3, 2, 1}, false},
+		},
+		{
+			js:      "Object.freeze([1, 2]).reverse();",
+			wantErr: FrozenObjectError{},
+		},
+		{
+			js:       "out([1, 2, 3, 4].filter((v) => [2, 4].includes(v)));",
+			wantResp: []interface{}{2, 4},
+		},
+		{
+			js:       "out([\"a\", \"b\", \"c\"].filter((v, i) => i === 1));",
+			wantResp: []interface{}{"b"},
+		},
+		{
+			js:       "out([1, 2].filter((v) => null));",
+			wantResp: []interface{}{},
+		},
+		{
+			js:      "[1, 2].filter((v) => v.x.y);",
+			wantErr: NotObjectError{},
+		},
+		{
+			js:           "const users = [{\"id\": 1}, {\"id\": 2}, {\"id\": 3}]; out(users.find((u) => { out(u.id); return u.id === 2; }));",
+			wantManyResp: []interface{}{1, 2, map[string]interface{}{"id": 2}},
+		},
+		{
+			js:           "out([1, 2, 3].findIndex((v, i) => { out(i); return v === 2; })); out([1].find((v) => false)); out([1].findIndex((v) => false));",
+			wantManyResp: []interface{}{0, 1, 1, nil, -1},
+		},
+		{
+			js:           "out([1, 2, 3].some((v, i) => { out(i); return v === 2; })); out([1, 2, 3].some((v) => false)); out([].some((v) => true));",
+			wantManyResp: []interface{}{0, 1, true, false, false},
+		},
+		{
+			js:           "out([1, 2, 3].every((v, i) => { out(i); return v === 1; })); out([1, 2, 3].every((v) => true)); out([].every((v) => false));",
+			wantManyResp: []interface{}{0, 1, false, true, true},
+		},
+		{
+			js:           "function Point(x, y) { this.x = x; this.y = y; } let p = new Point(1, 2); out(p.x); out(p.y); let q = new Point(3, 4); out(p.x + q.x);",
+			wantManyResp: []interface{}{1, 2, 4},
+		},
+		{
+			js:           "function Box(v) { this.v = v; return {w: v * 2}; } let b = new Box(2); out(b.w); out(b.v);",
+			wantManyResp: []interface{}{4, nil},
+		},
+		{
+			js:           "function Empty() { this.made = true; } let e = new Empty; out(e.made);",
+			wantManyResp: []interface{}{true},
+		},
+		{
+			js:           "const Anon = function() { this.n = 1; }; out(new Anon().n);",
+			wantManyResp: []interface{}{1},
+		},
+		{
+			js:           "class A { constructor(v) { this.v = v; } get() { return this.v; } name() { return \"a\"; } } class B extends A { constructor(v) { super(v * 2); this.w = v; } name() { return super.name() + \"b\"; } } const b = new B(3); out(b.get()); out(b.w); out(b.name());",
+			wantManyResp: []interface{}{6, 3, "ab"},
+		},
+		{
+			js:           "class A { constructor(v) { this.v = v; } } class B extends A { twice() { return this.v * 2; } } out(new B(4).twice());",
+			wantManyResp: []interface{}{8},
+		},
+		{
+			js:      "const A = 1; class B extends A {}",
+			wantErr: NotClassError{},
+		},
+		{
+			js:           "const grid = Array(3).fill(0).map(() => new Array(3).fill(0)); grid[1][2] = 5; out(grid);",
+			wantManyResp: []interface{}{[]interface{}{[]interface{}{0, 0, 0}, []interface{}{0, 0, 5}, []interface{}{0, 0, 0}}},
+		},
+		{
+			js:           "out(Array(1, 2, 3)); out(new Array(2)); out(Array(\"a\")); out([1, 2, 3, 4].fill(9, 1, -1)); out([1, 2, 3].fill(7, -2)); out([1, 2].fill(0, 5));",
+			wantManyResp: []interface{}{[]interface{}{1, 2, 3}, []interface{}{nil, nil}, []interface{}{"a"}, []interface{}{1, 9, 9, 4}, []interface{}{1, 7, 7}, []interface{}{1, 2}},
+		},
+		{
+			js:      "Array(-1);",
+			wantErr: InvalidArrayLengthError{},
+		},
+		{
+			js:           "const p = new Promise((resolve, reject) => { resolve(1); }); p.then((v) => { out(v); return v + 1; }).then((v) => { out(v); });",
+			wantManyResp: []interface{}{1, 2},
+		},
+		{
+			js:           "new Promise((resolve, reject) => { reject(\"no\"); }).then((v) => { out(v); }).catch((err) => { out(err); }); Promise.reject(3).catch((err) => { out(err); });",
+			wantManyResp: []interface{}{"no", 3},
+		},
+		{
+			js:           "Promise.all([Promise.resolve(1), 2, new Promise((resolve) => { resolve(3); })]).then((v) => { out(v); }); Promise.all([]).then((v) => { out(v); }); Promise.all([1, Promise.reject(\"bad\")]).catch((err) => { out(err); });",
+			wantManyResp: []interface{}{[]interface{}{1, 2, 3}, []interface{}{}, "bad"},
+		},
+		{
+			js:           "const resolvers = {}; const p = new Promise((resolve) => { resolvers.resolve = resolve; }); p.then((v) => { out(v); }); out(\"before\"); resolvers.resolve(\"after\");",
+			wantManyResp: []interface{}{"before", "after"},
+		},
+		{
+			js:           "out(Array.isArray([])); out(Array.isArray([1, 2])); out(Array.isArray(Array(2))); out(Array.isArray({})); out(Array.isArray(\"ab\")); out(Array.isArray(null)); out(Array.isArray(1));",
+			wantManyResp: []interface{}{true, true, true, false, false, false, false},
+		},
+		{
+			js:           "function* gen() { yield 1; yield 2; return 3; } const g = gen(); out(g.next()); out(g.next()); out(g.next()); out(g.next());",
+			wantManyResp: []interface{}{map[string]interface{}{"value": 1, "done": false}, map[string]interface{}{"value": 2, "done": false}, map[string]interface{}{"value": 3, "done": true}, map[string]interface{}{"value": nil, "done": true}},
+		},
+		{
+			js:           "function* count(n) { const c = {i: 0}; for (const x of [1, 2, 3]) { c.i = c.i + x; yield c.i * n; } } for (const v of count(10)) { out(v); }",
+			wantManyResp: []interface{}{10, 30, 60},
+		},
+		{
+			js:           "function* echo() { const a = yield \"first\"; out(a); const b = yield a + 1; out(b); } const g = echo(); out(g.next().value); out(g.next(5).value); out(g.next(7).done);",
+			wantManyResp: []interface{}{"first", 5, 6, 7, true},
+		},
+		{
+			js:           "function* inner() { yield 1; yield 2; } function* outer() { yield 0; yield* inner(); yield* [3, 4]; } for (const v of outer()) { out(v); }",
+			wantManyResp: []interface{}{0, 1, 2, 3, 4},
+		},
+		{
+			js:           "function* forever() { for (const x of [1, 2, 3, 4]) { out(\"step\"); yield x; } } const g = forever(); out(g.next().value); out(g.return(9)); out(g.next().done);",
+			wantManyResp: []interface{}{"step", 1, map[string]interface{}{"value": 9, "done": true}, true},
+		},
+		{
+			js:           "out(Array.from(\"abc\")); out(Array.from({length: 3}, (_, i) => i)); out(Array.from([1, 2], (v) => v * 2)); out(Array.from({length: 2, 0: \"x\"})); function* g() { yield 1; yield 2; } out(Array.from(g()));",
+			wantManyResp: []interface{}{[]interface{}{"a", "b", "c"}, []interface{}{0, 1, 2}, []interface{}{2, 4}, []interface{}{"x", nil}, []interface{}{1, 2}},
+		},
+		{
+			js:      "Array.from(1);",
+			wantErr: NotIterableError{},
+		},
+		{
+			js:           "out(Array.of(3)); out(Array(3)); out(Array.of()); out(Array.of(1, \"a\", null));",
+			wantManyResp: []interface{}{[]interface{}{3}, []interface{}{nil, nil, nil}, []interface{}{}, []interface{}{1, "a", nil}},
+		},
+		{
+			js:           "for (const x of [3, 2, 1]) { out(x); } for (const c of \"hi\") { out(c); }",
+			wantManyResp: []interface{}{3, 2, 1, "h", "i"},
+		},
+		{
+			js:           "const it = {n: 0, next: () => { it.n = it.n + 1; return {value: it.n, done: it.n === 3}; }}; for (const x of it) { out(x); }",
+			wantManyResp: []interface{}{1, 2},
+		},
+		{
+			js:      "for (const x of {a: 1}) { out(x); }",
+			wantErr: NotIterableError{},
+		},
+		{
+			js:           "const a = [1, 2]; a[\"1\"] = 5; out(a[\"0\"]); out(a);",
+			wantManyResp: []interface{}{1, []interface{}{1, 5}},
+		},
+		{
+			js:           "out([1, 2, 3].reduce((acc, el, idx, arr) => acc + el * idx + arr.length, 0)); out([\"a\", \"b\", \"c\"].reduce((acc, el) => acc + el)); out([5].reduce((acc, el) => acc * el)); out({x: 2}.reduce((acc, v, k) => acc + k + v, \"\"));",
+			wantManyResp: []interface{}{17, "abc", 5, "x2"},
+		},
+		{
+			js:      "[].reduce((acc, el) => acc + el);",
+			wantErr: EmptyReduceError{},
+		},
+		{
+			js:           "const s = new Set([1, \"1\", 1, 2.5]); out(s.size); out(s.has(1)); out(s.has(\"1\")); out(s.has(3)); s.add(3).add(1); out(Array.from(s)); out(s.delete(\"1\")); out(s.delete(\"1\")); for (const v of s) { out(v); }",
+			wantManyResp: []interface{}{3, true, true, false, []interface{}{1, "1", 2.5, 3}, true, false, 1, 2.5, 3},
+		},
+		{
+			js:           "const o = {}; const s = new Set(); s.add(o); s.add({}); s.add(o); out(s.size); out(s.has(o)); s.forEach((v, k, set) => { out(set.size); }); s.clear(); out(s.size);",
+			wantManyResp: []interface{}{2, true, 2, 2, 0},
+		},
+		{
+			js:           "out([1, 2].map((v) => v * 2)); out([1, 2].map((v, i) => v + i)); out([1, 2].map((v, i, a) => a.length)); [\"a\", \"b\"].forEach((v) => { out(v); }); [\"a\", \"b\"].forEach((v, i) => { out(i); }); [\"a\"].forEach((v, i, a) => { out(a); });",
+			wantManyResp: []interface{}{[]interface{}{2, 4}, []interface{}{1, 3}, []interface{}{2, 2}, "a", "b", 0, 1, []interface{}{"a"}},
+		},
+		{
+			js:           "const o = {x: 1}; o.forEach((v) => { out(v); }); o.forEach((v, k) => { out(k); }); o.forEach((v, k, obj) => { out(obj.x); }); out(o.map((v, k, obj) => [k + k, v + obj.x]));",
+			wantManyResp: []interface{}{1, "x", 1, map[string]interface{}{"xx": 2}},
+		},
+		{
+			js:           "const k = {}; const m = new Map([[1, \"int\"], [\"1\", \"string\"]]); m.set(k, \"object\").set(2.5, \"float\"); out(m.size); out(m.get(1)); out(m.get(\"1\")); out(m.get(k)); out(m.get({})); out(m.has(2.5)); out(m.delete(1)); out(m.has(1)); m.set(\"1\", \"again\"); for (const e of m) { out(e[0]); } m.forEach((v, key, mp) => { out(v); });",
+			wantManyResp: []interface{}{4, "int", "string", "object", nil, true, true, false, "1", map[string]interface{}{}, 2.5, "again", "object", "float"},
+		},
+		{
+			js:           "const a = [\"a\", \"b\", \"c\"]; const it = a.entries(); for (const [i, v] of it) { out(i); out(v); break; } out(it.next()); for (const k of a.keys()) { out(k); } out(Array.from(a.values()));",
+			wantManyResp: []interface{}{0, "a", map[string]interface{}{"value": []interface{}{1, "b"}, "done": false}, 0, 1, 2, []interface{}{"a", "b", "c"}},
+		},
+		{
+			js:           "for (const x of [1, 2, 3, 4]) { if (x === 2) { continue; } if (x === 4) { break; } out(x); } for (const i in [5, 6, 7]) { if (i === \"1\") { break; } out(i); } const [first, , third, ...rest] = [1, 2, 3, 4, 5]; out(first); out(third); out(rest);",
+			wantManyResp: []interface{}{1, 3, "0", 1, 3, []interface{}{4, 5}},
+		},
+		{
+			js:           "function* g() { out(\"one\"); yield 1; out(\"two\"); yield 2; } for (const v of g()) { out(v); break; }",
+			wantManyResp: []interface{}{"one", 1},
+		},
+		{
+			js:           "out([1, 2, 3, 4, 5].copyWithin(0, 3)); out([1, 2, 3, 4, 5].copyWithin(1, 0)); out([1, 2, 3, 4, 5].copyWithin(0, 1)); out([1, 2, 3, 4, 5].copyWithin(-2, 0, 2)); out([1, 2, 3, 4, 5].copyWithin(0, -2, -1)); out([1, 2, 3, 4, 5].copyWithin(9, 0)); out([1, 2, 3, 4, 5].copyWithin(0, 3, 1)); out([1, 2, 3].copyWithin(1));",
+			wantManyResp: []interface{}{[]interface{}{4, 5, 3, 4, 5}, []interface{}{1, 1, 2, 3, 4}, []interface{}{2, 3, 4, 5, 5}, []interface{}{1, 2, 3, 1, 2}, []interface{}{4, 2, 3, 4, 5}, []interface{}{1, 2, 3, 4, 5}, []interface{}{1, 2, 3, 4, 5}, []interface{}{1, 1, 2}},
+		},
+		{
+			js:           "const a = [1, 2, 3]; const b = a.copyWithin(0, 1); b[2] = 9; out(a);",
+			wantManyResp: []interface{}{[]interface{}{2, 3, 9}},
+		},
+		{
+			js:           "const o = {b: 1, a: 2, 2: \"x\", 1: \"y\"}; o.c = 3; o.b = 4; delete o.a; o.a = 5; for (const k in o) { out(k); }",
+			wantManyResp: []interface{}{"1", "2", "b", "c", "a"},
+		},
+		{
+			js:           "const o = Object.assign({z: 0}, {y: 1, x: 2}); const keys = []; o.forEach((v, k) => { keys.push(k); }); out(keys); out(o.reduce((acc, v, k) => acc + k, \"\")); const m = {q: 1, p: 2}.map((v, k) => [k + \"!\", v]); for (const k in m) { out(k); }",
+			wantManyResp: []interface{}{[]interface{}{"z", "y", "x"}, "zyx", "q!", "p!"},
+		},
+		{
+			js:           "const a = [1, 2, 3]; out(a.at(-1)); out(a.at(0)); out(a.at(3)); out(a.at(4)); out(a.at(-3)); out(a.at(-4)); out(a.at(1.7)); out(a.at());",
+			wantManyResp: []interface{}{3, 1, nil, nil, 1, nil, 2, 1},
+		},
+		{
+			js:           "const s = \"abc\"; out(s.at(-1)); out(s.at(0)); out(s.at(3)); out(s.at(4)); out(s.at(1.2)); out(\"é!\".at(0));",
+			wantManyResp: []interface{}{"c", "a", nil, nil, "b", "é"},
+		},
+		{
+			js:           "const a = [1, 2, 3]; a[5] = 6; out(a.length); out(a); out(a[4]); const o = {list: []}; o.list[2] = \"x\"; out(o.list); let b = []; for (const i of [0, 1, 2]) { b[i] = i * i; } out(b);",
+			wantManyResp: []interface{}{6, []interface{}{1, 2, 3, nil, nil, 6}, nil, []interface{}{nil, nil, "x"}, []interface{}{0, 1, 4}},
+		},
+		{
+			js:      "const a = [1]; a[-1] = 2;",
+			wantErr: IndexOutOfBoundsError{},
+		},
+		{
+			js:           "const a = [1]; out(a[1]); out(a[-1]); out(a[a.length]); out(a[0]);",
+			wantManyResp: []interface{}{nil, nil, nil, 1},
+		},
+		{
+			js:           "const s = \"héllo😀\"; out(s.length); out(s[\"length\"]); out(\"日本\".length);",
+			wantManyResp: []interface{}{7, 7, 2},
+		},
+		{
+			js:           "let n = 0; function inc() { n = n + 1; } inc(); inc(); out(n); for (const x of [1, 2]) { n = n + x; } out(n);",
+			wantManyResp: []interface{}{2, 5},
+		},
+		{
+			js:      "const n = 0; function inc() { n = 1; } inc();",
+			wantErr: scope.MutatingConstantError{},
+		},
+		{
+			js:           "out(\"straße\".toUpperCase()); out(\"ÅÄÖ Abc\".toLowerCase()); out(\"abc\".toLocaleUpperCase(\"en-US\")); out(\"ABC\".toLocaleLowerCase()); out(\"x\".toUpperCase(1, 2));",
+			wantManyResp: []interface{}{"STRASSE", "åäö abc", "ABC", "abc", "X"},
+		},
+		{
+			js:           "const s = \" \t\v\u00a0\ufeffab c\f\u3000 \"; out(s.trim()); out(s.trimStart()); out(s.trimEnd()); out(s.trimLeft() === s.trimStart()); out(s.trimRight() === s.trimEnd()); out(\" \t \".trim()); out(\"abc\".trim()); out(\"\u0085a\u0085\".trim());",
+			wantManyResp: []interface{}{"ab c", "ab c\f\u3000 ", " \t\v\u00a0\ufeffab c", true, true, "", "abc", "\u0085a\u0085"},
+		},
+		{
+			js:           "const s = \"abcabc\"; out(s.indexOf(\"c\")); out(s.indexOf(\"c\", 3)); out(s.indexOf(\"c\", -5)); out(s.indexOf(\"c\", 6)); out(s.indexOf(\"\")); out(s.indexOf(\"\", 4)); out(s.indexOf(\"\", 10)); out(s.indexOf(\"x\"));",
+			wantManyResp: []interface{}{2, 5, 2, -1, 0, 4, 6, -1},
+		},
+		{
+			js:           "const s = \"abcabc\"; out(s.includes(\"ca\")); out(s.includes(\"ca\", 3)); out(s.includes(\"\", 10)); out(s.includes(\"x\"));",
+			wantManyResp: []interface{}{true, false, true, false},
+		},
+		{
+			js:           "const s = \"abcabc\"; out(s.startsWith(\"ab\")); out(s.startsWith(\"ab\", 3)); out(s.startsWith(\"ab\", 4)); out(s.startsWith(\"ab\", -2)); out(s.startsWith(\"\", 10)); out(s.startsWith(\"abcabcd\"));",
+			wantManyResp: []interface{}{true, true, false, true, true, false},
+		},
+		{
+			js:           "const s = \"abcabc\"; out(s.endsWith(\"bc\")); out(s.endsWith(\"ab\", 5)); out(s.endsWith(\"ab\", 2)); out(s.endsWith(\"bc\", 10)); out(s.endsWith(\"\", -1)); out(s.endsWith(\"a\", -1));",
+			wantManyResp: []interface{}{true, true, true, true, true, false},
+		},
+		{
+			js:           "const s = \"😀a😀\"; out(s.indexOf(\"a\")); out(s.indexOf(\"😀\", 1)); out(s.startsWith(\"a\", 2)); out(s.endsWith(\"a\", 3));",
+			wantManyResp: []interface{}{2, 3, true, true},
+		},
+		{
+			js:           "const s = \"abcdefg\"; out(s.slice(2, 5)); out(s.slice(-3)); out(s.slice(2, -2)); out(s.slice(5, 2)); out(s.slice(10)); out(s.slice(-10, 2)); out(s.slice());",
+			wantManyResp: []interface{}{"cde", "efg", "cde", "", "", "ab", "abcdefg"},
+		},
+		{
+			js:           "const s = \"abcdefg\"; out(s.substring(2, 5)); out(s.substring(5, 2)); out(s.substring(-3)); out(s.substring(-3, 2)); out(s.substring(4, 10)); out(s.substring(10));",
+			wantManyResp: []interface{}{"cde", "cde", "abcdefg", "ab", "efg", ""},
+		},
+		{
+			js:           "const s = \"a😀b\"; out(s.slice(1, 3)); out(s.slice(-1)); out(s.substring(3));",
+			wantManyResp: []interface{}{"😀", "b", "b"},
+		},
+		{
+			js:           "const a = [1, 2, 3, 4]; const b = a.slice(1, -1); b[0] = 9; out(b); out(a.slice(-2)); out(a.slice(3, 1)); out(a[1]);",
+			wantManyResp: []interface{}{[]interface{}{9, 3}, []interface{}{3, 4}, []interface{}{}, 2},
+		},
+		{
+			js:           "const msg = \"hi {name}, bye {name}\"; out(msg.replace(\"{name}\", \"bob\")); out(msg.replaceAll(\"{name}\", \"bob\")); out(\"aaaa\".replaceAll(\"aa\", \"b\")); out(\"aaa\".replace(\"aa\", \"b\"));",
+			wantManyResp: []interface{}{"hi bob, bye {name}", "hi bob, bye bob", "bb", "ba"},
+		},
+		{
+			js:           "out(\"ab\".replace(\"\", \"-\")); out(\"ab\".replaceAll(\"\", \"-\")); out(\"\".replaceAll(\"\", \"-\")); out(\"a😀\".replaceAll(\"\", \"-\"));",
+			wantManyResp: []interface{}{"-ab", "-a-b-", "-", "-a-😀-"},
+		},
+		{
+			js:           "out(\"a-b-c\".replace(\"-\", (m, offset, s) => m + offset + s.length)); out(\"a-b-c\".replaceAll(\"-\", function(m, offset) { return \"[\" + offset + \"]\"; })); out(\"x-y\".replace(\"-\", \"$&$&$1\"));",
+			wantManyResp: []interface{}{"a-15b-c", "a[1]b[3]c", "x--$1y"},
+		},
+		{
+			js:           "out(\"john smith\".replace(/(\\w+) (\\w+)/, (m, first, last) => last + \" \" + first)); out(\"a1b2\".replaceAll(/\\d/g, (d) => d + d)); out(\"a1b2\".replace(/\\d/g, \"#\"));",
+			wantManyResp: []interface{}{"smith john", "a11b22", "a#b#"},
+		},
+		{
+			js:      "\"a1\".replaceAll(/\\d/, \"#\");",
+			wantErr: InvalidRegExpError{},
+		},
+		{
+			js:           "out(\"-\".repeat(3)); out(\"ab\".repeat(0)); out(\"\".repeat(5)); out(\"ab\" * 2);",
+			wantManyResp: []interface{}{"---", "", "", "abab"},
+		},
+		{
+			js:      "\"a\".repeat(-1);",
+			wantErr: InvalidCountError{},
+		},
+		{
+			js:           "out(\"42\".padStart(8, \"0\")); out(\"42\".padEnd(5, \"ab\")); out(\"abc\".padStart(6, \"123456\")); out(\"abc\".padStart(2, \"0\")); out(\"abc\".padEnd(5)); out(\"abc\".padEnd(6, \"\"));",
+			wantManyResp: []interface{}{"00000042", "42aba", "123abc", "abc", "abc  ", "abc"},
+		},
+		{
+			js:           "out(1 / 2); out(6 / 3); out(-7 / 2); out(1.5 / 3); out(6 / 3 === 2);",
+			wantManyResp: []interface{}{0.5, 2, -3.5, 0.5, true},
+		},
+		{
+			js:           "out(1 / 0); out(-1 / 0);",
+			wantManyResp: []interface{}{math.Inf(1), math.Inf(-1)},
+		},
+		{
+			js:           "out(\"ab\" === \"ab\"); out(\"ab\" === \"ba\"); out(\"\" === \"\"); out(\"1\" === 1);",
+			wantManyResp: []interface{}{true, false, true, false},
+		},
+		{
+			js:           "const a = [1, 2]; const b = a; const o = {x: 1}; const p = o; out([1, 2] === [1, 2]); out(a === a); out(a === b); out({x: 1} === {x: 1}); out(o === p); out(o === {x: 1}); out([] === []);",
+			wantManyResp: []interface{}{false, true, true, false, true, false, false},
+		},
+		{
+			js:      "function f(n) { return f(n + 1); } f(0);",
+			wantErr: StackOverflowError{},
+		},
+		{
+			js:      "function even(n) { if (n === 0) { return true; } else { return odd(n - 1); } } function odd(n) { if (n === 0) { return false; } else { return even(n - 1); } } even(100000);",
+			wantErr: StackOverflowError{},
+		},
+		{
+			js:       "function sum(n) { if (n === 0) { return 0; } else { return n + sum(n - 1); } } out(sum(500));",
+			wantResp: 125250,
+		},
+		{
+			js:           "const s = \"abc\"; out(s[0]); out(s[2]); out(s[s.length - 1]); out(s[3]); out(s[-1]); out(s[\"1\"]); out(s[\"length\"]); out(\"\"[0]);",
+			wantManyResp: []interface{}{"a", "c", "c", nil, nil, "b", 3, nil},
+		},
+		{
+			js:           "const s = \"a😀\"; out(s.length); out(s[0]); out(s[\"toUpperCase\"]()); out(s[\"nope\"]);",
+			wantManyResp: []interface{}{3, "a", "A😀", nil},
+		},
+		{
+			js:           "const log = \"GET /a 200, POST /b 404\"; out(log.match(/(\\w+) (\\S+) (\\d+)/)); out(log.match(/\\d+/g)); out(log.match(/PUT/)); out(log.match(/PUT/g));",
+			wantManyResp: []interface{}{[]interface{}{"GET /a 200", "GET", "/a", "200"}, []interface{}{"200", "404"}, nil, nil},
+		},
+		{
+			js:           "for (const m of \"GET /a 200, POST /b 404\".matchAll(/(\\w+) (\\S+) (\\d+)/g)) { out(m); } out(Array.from(\"a1b2\".matchAll(\"\\d\"))); out(Array.from(\"ab\".matchAll(/\\d/g)));",
+			wantManyResp: []interface{}{[]interface{}{"GET /a 200", "GET", "/a", "200"}, []interface{}{"POST /b 404", "POST", "/b", "404"}, []interface{}{[]interface{}{"1"}, []interface{}{"2"}}, []interface{}{}},
+		},
+		{
+			js:      "\"a1\".matchAll(/\\d/);",
+			wantErr: InvalidRegExpError{},
+		},
+		{
+			js:       "out(\"2024-05\".match(/(?<year>\\d+)-(?<month>\\d+)/));",
+			wantResp: []interface{}{"2024-05", "2024", "05"},
+		},
+		{
+			js:           "out(1e3 === 1000); out(1e3); out(2.5e3 === 2500); out(1e3 + 1); out(1e-3); out(1.5e-1 === 0.15); out(1e21);",
+			wantManyResp: []interface{}{true, 1000, true, 1001, 0.001, true, 1e21},
+		},
+		{
+			js:           "out([...\"abc\"]); out([...\"a😀b\"]); out([...\"a😀b\"].length); out([0, ...[1, 2], ...\"\", 3]);",
+			wantManyResp: []interface{}{[]interface{}{"a", "b", "c"}, []interface{}{"a", "😀", "b"}, 3, []interface{}{0, 1, 2, 3}},
+		},
+		{
+			js:           "for (const ch of \"h😀é\") { out(ch); }",
+			wantManyResp: []interface{}{"h", "😀", "é"},
+		},
+		{
+			js:           "const s = new Set([1, 2]); out([...s, ...new Map([[\"a\", 1]])]); function* g() { yield 1; yield 2; } out([...g()]);",
+			wantManyResp: []interface{}{[]interface{}{1, 2, []interface{}{"a", 1}}, []interface{}{1, 2}},
+		},
+		{
+			js:      "[...1];",
+			wantErr: NotIterableError{},
+		},
+		{
+			js:           "out(\"a\".localeCompare(\"b\")); out(\"b\".localeCompare(\"a\")); out(\"a\".localeCompare(\"a\")); out(\"B\".localeCompare(\"a\"));",
+			wantManyResp: []interface{}{-1, 1, 0, -1},
+		},
+		{
+			js:           "const names = [\"carol\", \"alice\", \"Bob\"]; names.sort((a, b) => a.localeCompare(b)); out(names); out([3, 1, 2].sort((a, b) => b - a)); out([\"b\", null, \"a\"].sort()); out([10, 9, 1].sort());",
+			wantManyResp: []interface{}{[]interface{}{"Bob", "alice", "carol"}, []interface{}{3, 2, 1}, []interface{}{"a", "b", nil}, []interface{}{1, 10, 9}},
+		},
+		{
+			js:           "out(String(1)); out(String(2.5)); out(String(true)); out(String(null)); out(String([1, [2, 3], null])); out(String({a: 1})); out(String({toString: () => \"custom\"})); out(String(\"s\")); out(String());",
+			wantManyResp: []interface{}{"1", "2.5", "true", "null", "1,2,3,", "[object Object]", "custom", "s", ""},
+		},
+		{
+			js:           "out(\"a\" + true); out(1 + \"b\"); out(\"c\" + null); out(\"d\" + [1, 2]); out(\"e\" + {}); out([1, 2.5, true].join(\"-\"));",
+			wantManyResp: []interface{}{"atrue", "1b", "cnull", "d1,2", "e[object Object]", "1-2.5-true"},
+		},
+		{
+			js:      "[1, 2].flatten();",
+			wantErr: UndefinedMethodError{},
+		},
+		{
+			js:      "\"abc\".reverse();",
+			wantErr: UndefinedMethodError{},
+		},
+		{
+			js:      "const o = {a: 1}; o.a();",
+			wantErr: NotCallableError{},
+		},
+		{
+			js:      "const o = {a: 1}; o.b();",
+			wantErr: NotCallableError{},
+		},
+		{
+			js:      "const n = 1; n.map((x) => x);",
+			wantErr: NotObjectError{},
+		},
+		{
+			js:           "out(1 < 2); out(2 < 1); out(2 <= 2); out(3 > 2.5); out(2 >= 3); out(\"a\" < \"b\"); out(\"B\" < \"a\"); out(\"abc\" < \"ab\"); out(\"10\" < \"9\");",
+			wantManyResp: []interface{}{true, false, true, true, false, true, true, false, true},
+		},
+		{
+			js:           "out(\"10\" < 9); out(\"10\" > 9); out(\"x\" < 9); out(\"x\" >= 9); out(null < 1); out(true > 0); out([2] > 1); out({} < 1);",
+			wantManyResp: []interface{}{false, true, false, false, true, true, true, false},
+		},
+		{
+			js:           "out(\"\uffff\" < \"😀\"); out(+\"42\"); out(+\" 1.5 \"); out(+\"\"); out(+true); out(+\"0x1f\"); out(+\"-Infinity\"); out(+null);",
+			wantManyResp: []interface{}{false, 42, 1.5, 0, 1, 31, math.Inf(-1), 0},
+		},
+		{
+			js:           "const a = [1, 2, 3]; out(a.first); out(a.last); out([].first); out([].last); a.push(4); out(a.last); out([5].first === [5].last);",
+			wantManyResp: []interface{}{1, 3, nil, nil, 4, true},
+		},
+		{
+			js:           "const s = \"a😀b\"; out(String.codePointCount(s)); out(s.length); out(String.codePointCount(\"\")); out(String.codePointCount(\"e\u0301\")); out(String.codePointCount(\"👍🏽\")); out(\"👍🏽\".length); out(String.codePointCount(\"👨‍👩‍👧\")); out([...\"👨‍👩‍👧\"].length);",
+			wantManyResp: []interface{}{3, 4, 0, 2, 2, 4, 5, 5},
+		},
+		{
+			js:           "out(\"ab\".repeat(3)); out(String(7).padStart(3, \"0\")); out(String(2.5).padEnd(5, \"0\")); out(\"id\".padEnd(4) + \"|\");",
+			wantManyResp: []interface{}{"ababab", "007", "2.500", "id  |"},
+		},
+		{
+			js:           "const o = {b: 1, a: 2, 2: 3, 1: 4}; o.c = 5; delete o.b; out(Object.keys(o)); out(Object.keys([7, 8])); out(Object.keys(null)); out(Object.keys(1)); out(Object.keys(true)); out(Object.keys(\"ab\")); out(Object.keys({}));",
+			wantManyResp: []interface{}{[]interface{}{"1", "2", "a", "c"}, []interface{}{"0", "1"}, []interface{}{}, []interface{}{}, []interface{}{}, []interface{}{"0", "1"}, []interface{}{}},
+		},
+		{
+			js:           "const o = {b: 1, a: 2}; o[0] = 3; out(Object.values(o)); out(Object.entries(o)); out(Object.values([4, 5])); out(Object.entries(\"hi\")); out(Object.values(null));",
+			wantManyResp: []interface{}{[]interface{}{3, 1, 2}, []interface{}{[]interface{}{"0", 3}, []interface{}{"b", 1}, []interface{}{"a", 2}}, []interface{}{4, 5}, []interface{}{[]interface{}{"0", "h"}, []interface{}{"1", "i"}}, []interface{}{}},
+		},
+		{
+			js:           "const o = {z: 1, y: 2}; for (const [k, v] of Object.entries(o)) { out(k + \"=\" + v); } const copy = Object.fromEntries(Object.entries(o)); out(Object.keys(copy)); out(copy.y); out(Object.fromEntries(new Map([[\"m\", 1]])));",
+			wantManyResp: []interface{}{"z=1", "y=2", []interface{}{"z", "y"}, 2, map[string]interface{}{"m": 1}},
+		},
+		{
+			js:      "Object.fromEntries([1]);",
+			wantErr: NotPairError{},
+		},
+		{
+			js:           "const s = \"aé😀\"; out(s.charCodeAt(0)); out(s.charCodeAt(1)); out(s.charCodeAt(2)); out(s.charCodeAt(3)); out(s.codePointAt(2)); out(s.codePointAt(3)); out(s.codePointAt(4)); out(s.charCodeAt());",
+			wantManyResp: []interface{}{97, 233, 55357, 56832, 128512, 56832, nil, 97},
+		},
+		{
+			js:           "out(String.fromCharCode(104, 105)); out(String.fromCharCode(55357, 56832)); out(String.fromCharCode()); out(String.fromCodePoint(128512, 97)); out(String.fromCharCode(65601));",
+			wantManyResp: []interface{}{"hi", "😀", "", "😀a", "A"},
+		},
+		{
+			js:           "const word = \"abc\"; let shifted = \"\"; for (const ch of word) { shifted = shifted + String.fromCharCode(ch.charCodeAt(0) + 1); } out(shifted);",
+			wantManyResp: []interface{}{"bcd"},
+		},
+		{
+			js:      "String.fromCodePoint(1114112);",
+			wantErr: InvalidCodePointError{},
+		},
+		{
+			js:           "const orig = {b: [1, {c: 2}], a: \"x\"}; const copy = structuredClone(orig); copy.b[1].c = 3; copy.b.push(4); out(orig.b[1].c); out(orig.b.length); out(copy); out(Object.keys(copy)); out(copy === orig); out(structuredClone(5));",
+			wantManyResp: []interface{}{2, 2, map[string]interface{}{"b": []interface{}{1, map[string]interface{}{"c": 3}, 4}, "a": "x"}, []interface{}{"b", "a"}, false, 5},
+		},
+		{
+			js:           "const shared = {n: 1}; const o = {x: shared, y: shared, e: [], f: []}; o.self = o; const c = structuredClone(o); out(c.x === c.y); out(c.x === shared); out(c.self === c); out(c.e === c.f); const s = structuredClone(new Set([shared])); out(s.has(shared)); out(s.size);",
+			wantManyResp: []interface{}{true, false, true, false, false, 1},
+		},
+		{
+			js:      "structuredClone({f: () => 1});",
+			wantErr: DataCloneError{},
+		},
+		{
+			js:           "const o = JSON.parse('{\"b\": [1, 2.5, 1e3, \"s\", true, null], \"a\": {\"c\": -2}}'); out(o.b); out(o.a.c === -2); out(Object.keys(o)); out(JSON.parse('3')); out(JSON.parse(' \"x\" '));",
+			wantManyResp: []interface{}{[]interface{}{1, 2.5, 1000, "s", true, nil}, true, []interface{}{"b", "a"}, 3, "x"},
+		},
+		{
+			js:      "JSON.parse('{\"a\": }');",
+			wantErr: JSONSyntaxError{},
+		},
+		{
+			js:      "JSON.parse('[1, 2');",
+			wantErr: JSONSyntaxError{},
+		},
+		{
+			js:      "JSON.parse('1 2');",
+			wantErr: JSONSyntaxError{},
+		},
+		{
+			js:           "const id = Symbol(\"id\"); const other = Symbol(\"id\"); const o = {a: 1}; o[id] = 2; out(o[id]); out(o[other]); out(Object.keys(o)); out(id === id); out(id === other); out(String(id)); out(id in o); out(other in o); delete o[id]; out(o[id]);",
+			wantManyResp: []interface{}{2, nil, []interface{}{"a"}, true, false, "Symbol(id)", true, false, nil},
+		},
+		{
+			js:           "const k = Symbol(); const o = {[k]: \"secret\", b: 1}; for (const key in o) { out(key); } out(o[k]); out(o.hasOwnProperty(k)); out(JSON.parse('{\"a\": 1}')[k]);",
+			wantManyResp: []interface{}{"b", "secret", true, nil},
+		},
+		{
+			js:           "const o = {b: [1, 2.5, \"s\t\", true, null], a: {c: -2}, f: () => 1}; out(JSON.stringify(o)); out(JSON.stringify(JSON.parse(JSON.stringify(o))) === JSON.stringify(o)); out(JSON.stringify([() => 1, 0/0])); out(JSON.stringify(() => 1));",
+			wantManyResp: []interface{}{"{\"b\":[1,2.5,\"s\\t\",true,null],\"a\":{\"c\":-2}}", true, "[null,null]", nil},
+		},
+		{
+			js:           "out(JSON.stringify({a: [1, {}], b: []}, null, 2)); out(JSON.stringify([1], null, \"--\"));",
+			wantManyResp: []interface{}{"{\n  \"a\": [\n    1,\n    {}\n  ],\n  \"b\": []\n}", "[\n--1\n]"},
+		},
+		{
+			js:           "out(JSON.stringify({a: 1, b: 2, c: 3}, [\"c\", \"a\"])); out(JSON.stringify({a: 1, b: \"x\"}, (k, v) => { let res = v; if (v === 1) { res = 10; } return res; }));",
+			wantManyResp: []interface{}{"{\"a\":1,\"c\":3}", "{\"a\":10,\"b\":\"x\"}"},
+		},
+		{
+			js:      "const o = {a: 1}; o.self = o; JSON.stringify(o);",
+			wantErr: CyclicStructureError{},
+		},
+		{
+			js:           "out(Math.floor(2.7)); out(Math.ceil(2.1)); out(Math.round(-2.5)); out(Math.trunc(-2.7)); out(Math.floor(3)); out(Math.abs(-3)); out(Math.abs(-1.5)); out(Math.sign(-4)); out(Math.sqrt(16)); out(Math.sqrt(2.25)); out(Math.sqrt(2) > 1.41);",
+			wantManyResp: []interface{}{2, 3, -2, -2, 3, 3, 1.5, -1, 4, 1.5, true},
+		},
+		{
+			js:           "out(Math.min(3, 1, 2)); out(Math.max(1, 2.5)); out(Math.min(1, 2.0)); out(Math.max()); out(Math.min()); out(Math.pow(2, 10)); out(Math.pow(2, -1)); out(Math.pow(2.0, 2)); out(Math.hypot(3, 4)); out(Math.exp(0)); out(Math.log(1)); out(Math.PI > 3.14);",
+			wantManyResp: []interface{}{1, 2.5, 1.0, math.Inf(-1), math.Inf(1), 1024, 0.5, 4.0, 5, 1, 0, true},
+		},
+		{
+			js:           "out(~5); out(~-1); out(~2.7); out(~~-2.7); out(~\"3\"); out(~\"x\"); out(~4294967296); out(~2147483648);",
+			wantManyResp: []interface{}{-6, 0, -3, -2, -4, -1, -1, 2147483647},
+		},
+		{
+			js:           "out(parseInt(\"42px\", 10) + parseFloat(\"0.5em\")); const n = parseInt(\"\"); out(n === n);",
+			wantManyResp: []interface{}{42.5, false},
+		},
+		{
+			js:           "out([].filter(x => x) === [2].filter(x => false)); const s = new Set([[1].filter(x => false)]); out(s.has([].filter(x => x))); out(Object.keys({}) === Object.values({})); out(Array.from([]) === Object.entries({}));",
+			wantManyResp: []interface{}{false, false, false, false},
+		},
+		{
+			js:           "const empty = [1, 2].slice(1, 1); Object.freeze([3].slice(5)); out(empty === [].slice()); empty.push(1); out(empty.length);",
+			wantManyResp: []interface{}{false, 1},
+		},
+		{
+			js:           "const a = [1]; const b = a; a.push(2); out(a === b); out(b.length); out(b); b.pop(); out(a); a[3] = 4; out(b.length);",
+			wantManyResp: []interface{}{true, 2, []interface{}{1, 2}, []interface{}{1}, 4},
+		},
+		{
+			js:           "const a = []; const s = new Set([a]); const m = new Map([[a, \"found\"]]); a.push(1); a[5] = 2; out(s.has(a)); out(m.get(a)); const o = {list: a}; o.list.push(3); out(a.length);",
+			wantManyResp: []interface{}{true, "found", 7},
+		},
+		{
+			js:           "function add(list) { list.push(1); } const a = []; add(a); add(a); out(a);",
+			wantManyResp: []interface{}{[]interface{}{1, 1}},
+		},
+		{
+			js:           "const o = JSON.parse('{\"b\": 1, \"a\": [1], \"1\": 2}'); o.c = 3; out(Object.keys(o)); out(JSON.stringify(o)); class C { z = 1; a = 2; } out(Object.keys(new C()));",
+			wantManyResp: []interface{}{[]interface{}{"1", "b", "a", "c"}, "{\"1\":2,\"b\":1,\"a\":[1],\"c\":3}", []interface{}{"z", "a"}},
+		},
+		{
+			js:           "Object.freeze([]); const b = []; b.push(1); out(b); out(Object.isFrozen([])); out(Object.isFrozen(Object.freeze([]))); out(Object.isFrozen(1));",
+			wantManyResp: []interface{}{[]interface{}{1}, false, true, true},
+		},
+		{
+			js:      "const a = Object.freeze([]); a.push(1);",
+			wantErr: FrozenObjectError{},
+		},
+		{
+			js:           "const m = \"at 2024-05\".match(/(?<year>\\d+)-(?<month>\\d+)/); out(m.index); out(m[\"input\"]); out(m.groups.year); out(m.groups.month); out(\"ab\".match(/b/).groups); out(/b/g.exec(\"abab\").index);",
+			wantManyResp: []interface{}{3, "at 2024-05", "2024", "05", nil, 1},
+		},
+		{
+			js:           "for (const m of \"a1 b22\".matchAll(/(?<digits>\\d+)/g)) { out([m[0], m.index, m.groups.digits]); } for (const m of \"ab\".matchAll(/x*/g)) { out(m.index); } const it = \"a1b2\".matchAll(/\\d/g); out(it.next().value.index); out(it.next().value.index); out(it.next().done);",
+			wantManyResp: []interface{}{[]interface{}{"1", 1, "1"}, []interface{}{"22", 4, "22"}, 0, 1, 2, 1, 3, true},
+		},
+		{
+			js:           "out(null === null); out(null === 1); out([null].includes(null)); out([1, null].indexOf(null)); out([null, 1, null].lastIndexOf(null)); const f = () => 1; const g = () => 2; out(f === g); out(f === f); const mk = () => () => 1; out(mk() === mk());",
+			wantManyResp: []interface{}{true, false, true, 1, 2, false, true, false},
+		},
+		{
+			js:           "const f = () => 1; const s = new Set([() => 1, () => 2, f, f]); out(s.size); const m = new Map(); m.set(() => 1, \"a\"); m.set(() => 2, \"b\"); m.set(f, \"c\"); out(m.size); out(m.get(f)); out(s.has(f));",
+			wantManyResp: []interface{}{3, 3, "c", true},
+		},
+		{
+			js:           "const re = new RegExp(\"a+\", \"g\"); out(re.source); out(re.global); out(\"caab\".replace(re, \"x\")); function F() { this.a = 1; return 5; } out(new F().a);",
+			wantManyResp: []interface{}{"a+", true, "cxb", 1},
+		},
+		{
+			js:           "out([[1, 2], [1]].sort()); out([10, 9, 1].sort()); out([{b: 1}, \"[object Obj\", \"z\"].sort());",
+			wantManyResp: []interface{}{[]interface{}{[]interface{}{1}, []interface{}{1, 2}}, []interface{}{1, 10, 9}, []interface{}{"[object Obj", map[string]interface{}{"b": 1}, "z"}},
+		},
+		{
+			js:           "out(\"ﬁne ŉ ᾳ ᾀ ǰ\".toUpperCase()); out(\"İ\".toLowerCase().length); out(\"ΣΑΣ\".toLowerCase());",
+			wantManyResp: []interface{}{"FINE ʼN ΑΙ ἈΙ J̌", 2, "σασ"},
+		},
+	} {
+		m := New()
+		InstallStdlib(m)
+		resp := []interface{}{}
+		m.Globals["out"] = func(i interface{}) (interface{}, error) {
+			resp = append(resp, i)
+			return nil, nil
+		}
+		ast, err := js.Parse(parse.NewInputString(tst.js))
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		err = m.NewRuntime().Run(ast)
+		if err != nil && tst.wantErr == nil {
+			t.Errorf("%q produced %v", tst.js, err)
+			continue
+		}
+		if (err == nil && tst.wantErr != nil) || (reflect.TypeOf(tst.wantErr) != reflect.TypeOf(err)) {
+			t.Errorf("%q produced %v, wanted %v", tst.js, err, tst.wantErr)
+			continue
+		}
+		if err == nil {
+			if tst.wantResp != nil {
+				if len(resp) != 1 {
+					t.Errorf("%q produced %v, expected a single value", tst.js, resp)
+				}
+				if !reflect.DeepEqual(resp[0], tst.wantResp) {
+					t.Errorf("%q produced %#v, want single value %#v", tst.js, resp[0], tst.wantResp)
+				}
+			}
+			if tst.wantManyResp != nil {
+				if !reflect.DeepEqual(resp, tst.wantManyResp) {
+					t.Errorf("%q produced %#v, want multi values %#v", tst.js, resp, tst.wantManyResp)
+				}
+			}
+		}
+	}
+}
+
+func TestModules(t *testing.T) {
+	for _, tst := range []struct {
+		modules  MapLoader
+		js       string
+		wantResp []interface{}
+		wantErr  error
+	}{
+		{
+			modules: MapLoader{
+				"util.js": "export function helper(x) { return x * 2; }; export const name = \"util\";",
+			},
+			js:       "import {helper, name} from \"./util.js\"; out(helper(2)); out(name);",
+			wantResp: []interface{}{4, "util"},
+		},
+		{
+			modules: MapLoader{
+				"lib/a.js": "import {b} from \"./b.js\"; export default b + 1;",
+				"lib/b.js": "let b = 1; b = 2; export {b};",
+			},
+			js:       "import a from \"./lib/a.js\"; import * as b from \"lib/b.js\"; out(a); out(b.b);",
+			wantResp: []interface{}{3, 2},
+		},
+		{
+			modules: MapLoader{
+				"a.js": "export {x as y} from \"./b.js\"; export * from \"./b.js\";",
+				"b.js": "export const x = 1; export const z = 2;",
+			},
+			js:       "import {y as w, z} from \"./a.js\"; out(w); out(z);",
+			wantResp: []interface{}{1, 2},
+		},
+		{
+			modules: MapLoader{
+				"counter.js": "export const c = {\"n\": 0}; c.n = c.n + 1;",
+			},
+			js:       "import {c} from \"./counter.js\"; import {c as d} from \"./counter.js\"; out(c.n); out(d.n);",
+			wantResp: []interface{}{1, 1},
+		},
+		{
+			modules: MapLoader{
+				"a.js": "import {b} from \"./b.js\"; export const a = 1;",
+				"b.js": "import {a} from \"./a.js\"; export const b = 1;",
+			},
+			js:      "import {a} from \"./a.js\";",
+			wantErr: CyclicImportError{},
+		},
+		{
+			modules: MapLoader{},
+			js:      "import {a} from \"./a.js\";",
+			wantErr: ModuleNotFoundError{},
+		},
+		{
+			modules: MapLoader{
+				"a.js": "export const a = 1;",
+			},
+			js:      "import {b} from \"./a.js\";",
+			wantErr: ExportNotFoundError{},
+		},
+	} {
+		m := New()
+		m.ModuleLoader = tst.modules
+		resp := []interface{}{}
+		m.Globals["out"] = func(i interface{}) (interface{}, error) {
+			resp = append(resp, i)
+			return nil, nil
+		}
+		ast, err := js.Parse(parse.NewInputString(tst.js))
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		err = m.NewRuntime().Run(ast)
+		if reflect.TypeOf(tst.wantErr) != reflect.TypeOf(err) {
+			t.Errorf("%q produced %v, wanted %v", tst.js, err, tst.wantErr)
+			continue
+		}
+		if err == nil && !reflect.DeepEqual(resp, tst.wantResp) {
+			t.Errorf("%q produced %#v, want %#v", tst.js, resp, tst.wantResp)
+		}
+	}
+}
+
+func TestFSLoader(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gojuice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := os.Mkdir(filepath.Join(dir, "lib"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "lib", "a.js"), []byte("export {b as a} from \"./b.js\";"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "lib", "b.js"), []byte("export const b = 7;"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	m := New()
+	m.ModuleLoader = FSLoader{Dir: dir}
+	var resp interface{}
+	m.Globals["out"] = func(i interface{}) (interface{}, error) {
+		resp = i
+		return nil, nil
+	}
+	ast, err := js.Parse(parse.NewInputString("import {a} from \"./lib/a.js\"; out(a);"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.NewRuntime().Run(ast); err != nil {
+		t.Fatal(err)
+	}
+	if resp != 7 {
+		t.Errorf("got %v, wanted 7", resp)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "secret.js"), []byte("export const s = 1;"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	m.ModuleLoader = FSLoader{Dir: filepath.Join(dir, "lib")}
+	for _, src := range []string{
+		"import {s} from \"../secret.js\";",
+		"import {s} from \"./../secret.js\";",
+		"import {s} from \"lib/../../secret.js\";",
+	} {
+		if _, err := m.NewRuntime().RunInteractive(src); reflect.TypeOf(err) != reflect.TypeOf(ModuleNotFoundError{}) {
+			t.Errorf("%q: got %#v, wanted a ModuleNotFoundError", src, err)
+		}
+	}
+}
+
+type recordingLoader struct {
+	MapLoader
+	resolved [][2]string
+}
+
+func (r *recordingLoader) Resolve(specifier, referrer string) (string, error) {
+	r.resolved = append(r.resolved, [2]string{specifier, referrer})
+	return r.MapLoader.Resolve(specifier, referrer)
+}
+
+func TestDynamicImport(t *testing.T) {
+	loader := &recordingLoader{
+		MapLoader: MapLoader{
+			"plugins/host.js": "export function load(which) { const name = \"./\" + which + \".js\"; return import(name); };",
+			"plugins/a.js":    "export const x = \"a\";",
+			"plugins/b.js":    "export const x = \"b\";",
+		},
+	}
+	m := New()
+	m.ModuleLoader = loader
+	resp := []interface{}{}
+	m.Globals["out"] = func(i interface{}) (interface{}, error) {
+		resp = append(resp, i)
+		return nil, nil
+	}
+	ast, err := js.Parse(parse.NewInputString("import {load} from \"./plugins/host.js\"; const which = \"b\"; load(which).then((ns) => { out(ns.x); }); load(\"c\").catch((err) => { out(\"failed\"); });"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.NewRuntime().Run(ast); err != nil {
+		t.Fatal(err)
+	}
+	want := []interface{}{"b", "failed"}
+	if !reflect.DeepEqual(resp, want) {
+		t.Errorf("got %+v, wanted %+v", resp, want)
+	}
+	wantResolved := [][2]string{
+		{"./plugins/host.js", ""},
+		{"./b.js", "plugins/host.js"},
+		{"./c.js", "plugins/host.js"},
+	}
+	if !reflect.DeepEqual(loader.resolved, wantResolved) {
+		t.Errorf("got %+v, wanted %+v", loader.resolved, wantResolved)
+	}
+}
+
+func TestDebuggerHook(t *testing.T) {
+	m := New()
+	ast, err := js.Parse(parse.NewInputString("function f(x) { debugger; }; f(1); debugger; f(2);"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.NewRuntime().Run(ast); err != nil {
+		t.Fatal(err)
+	}
+	seen := []interface{}{}
+	stop := fmt.Errorf("stop")
+	r := m.NewRuntime()
+	r.DebuggerHook = func(e *Evaluator, stmt *js.DebuggerStmt) error {
+		x, err := e.Runtime.Lookup("x")
+		if err != nil {
+			return stop
+		}
+		seen = append(seen, x)
+		return nil
+	}
+	if err := r.Run(ast); err != stop {
+		t.Errorf("got %v, wanted %v", err, stop)
+	}
+	if want := []interface{}{1}; !reflect.DeepEqual(seen, want) {
+		t.Errorf("got %+v, wanted %+v", seen, want)
+	}
+}
+
+func TestStep(t *testing.T) {
+	m := New()
+	ast, err := js.Parse(parse.NewInputString("const a = 1; function f(x) { const y = x + a; return y; }; f(2); const b = 3;"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := m.NewRuntime()
+	steps := 0
+	var atReturn map[string]interface{}
+	resume := make(chan struct{})
+	paused := make(chan struct{})
+	r.Step = func(stmt js.IStmt, s *scope.S) error {
+		steps++
+		if _, ok := stmt.(*js.ReturnStmt); ok {
+			atReturn = s.Visible()
+			delete(atReturn, "f")
+			paused <- struct{}{}
+			<-resume
+		}
+		return nil
+	}
+	done := make(chan error)
+	go func() {
+		done <- r.Run(ast)
+	}()
+	<-paused
+	if want := map[string]interface{}{"a": 1, "x": 2, "y": 3}; !reflect.DeepEqual(atReturn, want) {
+		t.Errorf("got %+v in scope, wanted %+v", atReturn, want)
+	}
+	close(resume)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if names, want := r.Scope.Names(), []string{"a", "b", "f"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("got names %+v, wanted %+v", names, want)
+	}
+	constants := []string{}
+	r.Scope.Each(func(name string, b *scope.Binding) {
+		if b.Constant {
+			constants = append(constants, name)
+		}
+	})
+	if want := []string{"a", "b", "f"}; !reflect.DeepEqual(constants, want) {
+		t.Errorf("got constants %+v, wanted %+v", constants, want)
+	}
+	if steps != 6 {
+		t.Errorf("got %v steps, wanted 6", steps)
+	}
+	stop := fmt.Errorf("stop")
+	r = m.NewRuntime()
+	r.Step = func(stmt js.IStmt, s *scope.S) error {
+		if s.Get("b") == nil && s.Lookup("a") != nil {
+			if _, ok := stmt.(*js.VarDecl); ok {
+				return stop
+			}
+		}
+		return nil
+	}
+	if err := r.Run(ast); err != stop {
+		t.Errorf("got %v, wanted %v", err, stop)
+	}
+}
+
+type testConfig struct {
+	Name string
+}
+
+func TestIsType(t *testing.T) {
+	m := New()
+	InstallStdlib(m)
+	m.RegisterType("Config", reflect.TypeOf(testConfig{}))
+	m.RegisterType("Map", reflect.TypeOf(map[string]interface{}{}))
+	m.Globals["config"] = testConfig{Name: "a"}
+	m.Globals["configPtr"] = &testConfig{Name: "b"}
+	resp := []interface{}{}
+	m.Globals["out"] = func(i interface{}) (interface{}, error) {
+		resp = append(resp, i)
+		return nil, nil
+	}
+	ast, err := js.Parse(parse.NewInputString("out(isType(config, \"Config\")); out(isType(configPtr, \"Config\")); out(isType({}, \"Config\")); out(isType({}, \"Map\")); out(isType(null, \"Config\"));"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.NewRuntime().Run(ast); err != nil {
+		t.Fatal(err)
+	}
+	want := []interface{}{true, true, false, true, false}
+	if !reflect.DeepEqual(resp, want) {
+		t.Errorf("got %+v, wanted %+v", resp, want)
+	}
+	if ast, err = js.Parse(parse.NewInputString("isType(config, \"Unknown\");")); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.NewRuntime().Run(ast); reflect.TypeOf(err) != reflect.TypeOf(NotDeclaredError{}) {
+		t.Errorf("got %v, wanted a NotDeclaredError", err)
+	}
+}
+
+func TestIncludesNaN(t *testing.T) {
+	m := New()
+	m.Globals["nan"] = math.NaN()
+	resp := []interface{}{}
+	m.Globals["out"] = func(i interface{}) (interface{}, error) {
+		resp = append(resp, i)
+		return nil, nil
+	}
+	ast, err := js.Parse(parse.NewInputString("const a = [1, nan]; out(a.includes(nan)); out(a.indexOf(nan)); out(a.lastIndexOf(nan));"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.NewRuntime().Run(ast); err != nil {
+		t.Fatal(err)
+	}
+	want := []interface{}{true, -1, -1}
+	if !reflect.DeepEqual(resp, want) {
+		t.Errorf("got %+v, wanted %+v", resp, want)
+	}
+}
+
+func TestMathRandom(t *testing.T) {
+	m := New()
+	InstallStdlib(m)
+	ast, err := js.Parse(parse.NewInputString("out(Math.random()); out(Math.random());"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	run := func(seed int64) []interface{} {
+		resp := []interface{}{}
+		m.Globals["out"] = func(i interface{}) (interface{}, error) {
+			resp = append(resp, i)
+			return nil, nil
+		}
+		r := m.NewRuntime()
+		r.SetRandSource(rand.NewSource(seed))
+		if err := r.Run(ast); err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+	first := run(42)
+	rnd := rand.New(rand.NewSource(42))
+	want := []interface{}{rnd.Float64(), rnd.Float64()}
+	if !reflect.DeepEqual(first, want) {
+		t.Errorf("got %+v, wanted %+v", first, want)
+	}
+	if second := run(42); !reflect.DeepEqual(second, first) {
+		t.Errorf("got %+v, wanted %+v", second, first)
+	}
+	if other := run(43); reflect.DeepEqual(other, first) {
+		t.Errorf("got %+v for different seeds", other)
+	}
+	m.RandSource = rand.NewSource(42)
+	resp := []interface{}{}
+	m.Globals["out"] = func(i interface{}) (interface{}, error) {
+		resp = append(resp, i)
+		return nil, nil
+	}
+	if err := m.NewRuntime().Run(ast); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(resp, first) {
+		t.Errorf("got %+v from M.RandSource, wanted %+v", resp, first)
+	}
+}
+
+func TestDate(t *testing.T) {
+	m := New()
+	InstallStdlib(m)
+	resp := []interface{}{}
+	m.Globals["out"] = func(i interface{}) (interface{}, error) {
+		resp = append(resp, i)
+		return nil, nil
+	}
+	ast, err := js.Parse(parse.NewInputString("out(Date.now()); const d = new Date(); out(d.toISOString()); out(d.getFullYear()); out(new Date(0).toISOString()); out(new Date(2020, 1, 29, 12).toISOString()); out(new Date(\"2021-03-04T05:06:07Z\").getTime());"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := m.NewRuntime()
+	r.SetClock(func() time.Time {
+		return time.Date(2022, 5, 6, 7, 8, 9, 10*int(time.Millisecond), time.UTC)
+	})
+	if err := r.Run(ast); err != nil {
+		t.Fatal(err)
+	}
+	want := []interface{}{1651820889010, "2022-05-06T07:08:09.010Z", 2022, "1970-01-01T00:00:00.000Z", "2020-02-29T12:00:00.000Z", 1614834367000}
+	if !reflect.DeepEqual(resp, want) {
+		t.Errorf("got %+v, wanted %+v", resp, want)
+	}
+}
+
+func TestSetClockDelays(t *testing.T) {
+	r := New().NewRuntime()
+	r.SetClock(time.Now)
+	fired := time.Time{}
+	r.Globals["fire"] = func() (interface{}, error) {
+		fired = time.Now()
+		return nil, nil
+	}
+	start := time.Now()
+	if _, err := r.RunInteractive("setTimeout(fire, 50);"); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.RunLoop(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := fired.Sub(start); elapsed < 50*time.Millisecond {
+		t.Errorf("timer fired after %v, wanted at least 50ms", elapsed)
+	}
+}
+
+func TestSandboxedRuntime(t *testing.T) {
+	m := New()
+	InstallStdlib(m)
+	m.Globals["secret"] = "s3cr3t"
+	resp := []interface{}{}
+	m.Globals["out"] = func(i interface{}) (interface{}, error) {
+		resp = append(resp, i)
+		return nil, nil
+	}
+	for _, tst := range []struct {
+		js      string
+		wantErr error
+	}{
+		{js: "out(Math.random());", wantErr: nil},
+		{js: "out(secret);", wantErr: NotDeclaredError{}},
+		{js: "setTimeout(() => {}, 1);", wantErr: NotDeclaredError{}},
+		{js: "out(Object.assign({}, {}));", wantErr: NotDeclaredError{}},
+	} {
+		ast, err := js.Parse(parse.NewInputString(tst.js))
+		if err != nil {
+			t.Fatal(err)
+		}
+		r := m.NewSandboxedRuntime("out", "Math")
+		if err := r.Run(ast); reflect.TypeOf(err) != reflect.TypeOf(tst.wantErr) {
+			t.Errorf("%q produced %v, wanted %v", tst.js, err, tst.wantErr)
+		}
+	}
+	ast, err := js.Parse(parse.NewInputString("out(secret);"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.NewRuntime().Run(ast); err != nil {
+		t.Errorf("trusted runtime produced %v", err)
+	}
+}
+
+type countingThrottler struct {
+	evaluations int
+	resets      int
+}
+
+func (c *countingThrottler) ThrottleAllocation(interface{}) error {
+	return nil
+}
+
+func (c *countingThrottler) ThrottleEnterEvaluation(interface{}) error {
+	c.evaluations++
+	return nil
+}
+
+func (c *countingThrottler) ThrottleExitEvaluation(interface{}) {}
+
+func (c *countingThrottler) Reset() {
+	c.evaluations = 0
+	c.resets++
+}
+
+func TestReset(t *testing.T) {
+	m := New()
+	resp := []interface{}{}
+	m.Globals["out"] = func(i interface{}) (interface{}, error) {
+		resp = append(resp, i)
+		return nil, nil
+	}
+	ast, err := js.Parse(parse.NewInputString("const a = [1]; a.push(2); out(a); setTimeout(() => {}, 10);"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	throttler := &countingThrottler{}
+	r := m.NewRuntime()
+	r.Throttler = throttler
+	if err := r.Run(ast); err != nil {
+		t.Fatal(err)
+	}
+	evaluations := throttler.evaluations
+	if _, err := r.Lookup("a"); err != nil {
+		t.Errorf("got %v, wanted a to be declared before reset", err)
+	}
+	r.Reset()
+	if _, err := r.Lookup("a"); reflect.TypeOf(err) != reflect.TypeOf(NotDeclaredError{}) {
+		t.Errorf("got %v, wanted a NotDeclaredError after reset", err)
+	}
+	if throttler.resets != 1 || throttler.evaluations != 0 {
+		t.Errorf("got %+v, wanted the throttler reset", throttler)
+	}
+	if got := r.PendingTimers(); got != 0 {
+		t.Errorf("got %v pending timers, wanted 0", got)
+	}
+	resp = nil
+	if err := r.Run(ast); err != nil {
+		t.Fatal(err)
+	}
+	if want := []interface{}{[]interface{}{1, 2}}; !reflect.DeepEqual(resp, want) {
+		t.Errorf("got %+v, wanted %+v", resp, want)
+	}
+	if throttler.evaluations != evaluations {
+		t.Errorf("got %v evaluations, wanted %v", throttler.evaluations, evaluations)
+	}
+}
+
+func TestProgram(t *testing.T) {
+	p, err := Compile("const c = {\"n\": 0}; function inc() { c.n = c.n + 1; return c.n; }; inc() + inc();")
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := New()
+	for i := 0; i < 3; i++ {
+		res, err := m.NewRuntime().RunProgram(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res != 3 {
+			t.Errorf("got %v, wanted 3", res)
+		}
+	}
+	if _, err := Compile("const = ;"); err == nil {
+		t.Errorf("wanted a parse error")
+	}
+}
+
+func TestRunInteractive(t *testing.T) {
+	r := New().NewRuntime()
+	for _, step := range []struct {
+		src     string
+		want    interface{}
+		wantErr bool
+	}{
+		{src: "let x = 1;", want: 1},
+		{src: "x = x + 1; x;", want: 2},
+		{src: "function f() { return x * 10; }", want: nil},
+		{src: "let = ;", wantErr: true},
+		{src: "f();", want: 20},
+		{src: "const o = {n: 1}; o.n;", want: 1},
+		{src: "o.n = 2; f() + o.n;", want: 22},
+	} {
+		got, err := r.RunInteractive(step.src)
+		if step.wantErr {
+			if err == nil {
+				t.Errorf("%q: wanted an error", step.src)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%q: %v", step.src, err)
+		}
+		if _, ok := got.(Func); ok {
+			got = nil
+		}
+		if got != step.want {
+			t.Errorf("%q: got %#v, wanted %#v", step.src, got, step.want)
+		}
+	}
+}
+
+func TestRunKeepsTopLevelBindings(t *testing.T) {
+	m := New()
+	resp := []interface{}{}
+	m.Globals["out"] = func(i interface{}) (interface{}, error) {
+		resp = append(resp, i)
+		return nil, nil
+	}
+	r := m.NewRuntime()
+	for _, src := range []string{
+		"const prefix = \"> \"; let count = 0; function show(s) { count = count + 1; out(prefix + s); }",
+		"show(\"a\"); show(\"b\"); out(count);",
+	} {
+		ast, err := js.Parse(parse.NewInputString(src))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := r.Run(ast); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if want := []interface{}{"> a", "> b", 2}; !reflect.DeepEqual(resp, want) {
+		t.Errorf("got %#v, wanted %#v", resp, want)
+	}
+	if _, err := r.Lookup("prefix"); err != nil {
+		t.Errorf("got %v looking up prefix after Run", err)
+	}
+}
+
+func TestOutput(t *testing.T) {
+	r := New().NewRuntime()
+	ast, err := js.Parse(parse.NewInputString("const a = 2; a * 3; function f() { 10; return a + 1; } f(); if (a === 2) { 99; } \"done\";"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Run(ast); err != nil {
+		t.Fatal(err)
+	}
+	if want := []interface{}{6, 3, "done"}; !reflect.DeepEqual(r.Output, want) {
+		t.Errorf("got %#v, wanted %#v", r.Output, want)
+	}
+	if _, err := r.RunInteractive("a + 1;"); err != nil {
+		t.Fatal(err)
+	}
+	if want := []interface{}{6, 3, "done", 3}; !reflect.DeepEqual(r.Output, want) {
+		t.Errorf("got %#v, wanted %#v", r.Output, want)
+	}
+	r.Reset()
+	if len(r.Output) != 0 {
+		t.Errorf("got %#v after Reset, wanted nothing", r.Output)
+	}
+}
+
+func TestCallVariadic(t *testing.T) {
+	join := func(sep string, parts ...interface{}) (interface{}, error) {
+		return fmt.Sprint(sep, len(parts), parts), nil
+	}
+	strs := func(parts ...string) (interface{}, error) {
+		return len(parts), nil
+	}
+	half := func(f float64) (interface{}, error) {
+		return f / 2, nil
+	}
+	last := func(parts ...string) (interface{}, error) {
+		return parts[len(parts)-1], nil
+	}
+	count := func(m map[string]interface{}, l []interface{}) (interface{}, error) {
+		return len(m) + len(l), nil
+	}
+	for _, tst := range []struct {
+		f       interface{}
+		args    []interface{}
+		want    interface{}
+		wantErr error
+	}{
+		{f: join, args: []interface{}{"-"}, want: "-0 []"},
+		{f: join, args: []interface{}{"-", 1}, want: "-1 [1]"},
+		{f: join, args: []interface{}{"-", 1, "a", 2.5}, want: "-3 [1 a 2.5]"},
+		{f: join, args: []interface{}{"-", nil, nil}, want: "-2 [<nil> <nil>]"},
+		{f: join, args: []interface{}{"-", []interface{}{1, 2}}, want: "-1 [[1 2]]"},
+		{f: join, args: []interface{}{}, wantErr: WrongNumberOfArgsError{}},
+		{f: join, args: []interface{}{1}, wantErr: WrongArgTypeError{}},
+		{f: strs, args: []interface{}{}, want: 0},
+		{f: strs, args: []interface{}{"a", "b"}, want: 2},
+		{f: strs, args: []interface{}{"a", nil}, want: 2},
+		{f: join, args: []interface{}{nil}, want: "0 []"},
+		{f: last, args: []interface{}{"a", nil}, want: ""},
+		{f: count, args: []interface{}{nil, nil}, want: 0},
+		{f: half, args: []interface{}{nil}, want: 0.0},
+		{f: strs, args: []interface{}{"a", 1}, wantErr: WrongArgTypeError{}},
+		{f: half, args: []interface{}{3}, want: 1.5},
+	} {
+		got, err := Call(tst.f, tst.args)
+		if tst.wantErr != nil {
+			if reflect.TypeOf(err) != reflect.TypeOf(tst.wantErr) {
+				t.Errorf("%+v: got %v, wanted %T", tst.args, err, tst.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%+v: %v", tst.args, err)
+		} else if got != tst.want {
+			t.Errorf("%+v: got %#v, wanted %#v", tst.args, got, tst.want)
+		}
+	}
+}
+
+func TestCallFunc(t *testing.T) {
+	p, err := Compile("const base = 10; (x) => x + base;")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := New().NewRuntime().RunProgram(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, ok := res.(Func)
+	if !ok {
+		t.Fatalf("got %#v, wanted a Func", res)
+	}
+	if got, err := CallFunc(f, 5); err != nil || got != 15 {
+		t.Errorf("got %v, %v, wanted 15", got, err)
+	}
+	if _, err := CallFunc(5); reflect.TypeOf(err) != reflect.TypeOf(NotCallableError{}) {
+		t.Errorf("got %v, wanted a NotCallableError", err)
+	}
+}
+
+func TestLegacyReduce(t *testing.T) {
+	m := New()
+	m.LegacyReduce = true
+	resp := []interface{}{}
+	m.Globals["out"] = func(i interface{}) (interface{}, error) {
+		resp = append(resp, i)
+		return nil, nil
+	}
+	ast, err := js.Parse(parse.NewInputString("out([1, 2, 3].reduce((el, sum) => sum - el, 0)); out({x: 1}.reduce((k, v, sum) => sum + k + v, \"\"));"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.NewRuntime().Run(ast); err != nil {
+		t.Fatal(err)
+	}
+	if want := []interface{}{-6, "x1"}; !reflect.DeepEqual(resp, want) {
+		t.Errorf("got %#v, wanted %#v", resp, want)
+	}
+}
+
+type recordingTracer struct {
+	nodes  []interface{}
+	depths []int
+}
+
+func (r *recordingTracer) OnEval(node interface{}, depth int) {
+	r.nodes = append(r.nodes, node)
+	r.depths = append(r.depths, depth)
+}
+
+func TestTracer(t *testing.T) {
+	m := New()
+	tracer := &recordingTracer{}
+	m.Tracer = tracer
+	ast, err := js.Parse(parse.NewInputString("const a = 1 + 2;"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.NewRuntime().Run(ast); err != nil {
+		t.Fatal(err)
+	}
+	if len(tracer.nodes) == 0 {
+		t.Fatal("got no trace events")
+	}
+	if _, ok := tracer.nodes[0].(*js.VarDecl); !ok || tracer.depths[0] != 0 {
+		t.Errorf("got first event %#v at depth %v, wanted the declaration at depth 0", tracer.nodes[0], tracer.depths[0])
+	}
+	foundBinary := false
+	for idx, node := range tracer.nodes {
+		if _, ok := node.(*js.BinaryExpr); ok {
+			foundBinary = true
+			if tracer.depths[idx] != 1 {
+				t.Errorf("got binary expression at depth %v, wanted 1", tracer.depths[idx])
+			}
+		}
+	}
+	if !foundBinary {
+		t.Errorf("got no binary expression event in %#v", tracer.nodes)
+	}
+	runtimeTracer := &recordingTracer{}
+	r := m.NewRuntime()
+	r.Tracer = runtimeTracer
+	if err := r.Run(ast); err != nil {
+		t.Fatal(err)
+	}
+	if len(runtimeTracer.nodes) != len(tracer.nodes) {
+		t.Errorf("got %v runtime tracer events, wanted %v", len(runtimeTracer.nodes), len(tracer.nodes))
+	}
+}
+
+type growthLimiter struct {
+	maxLength int
+}
+
+func (g growthLimiter) ThrottleAllocation(i interface{}) error {
+	if growth, ok := i.(ArrayGrowth); ok && growth.Length > g.maxLength {
+		return fmt.Errorf("array of length %v is too long", growth.Length)
+	}
+	if growth, ok := i.(StringGrowth); ok && growth.Length > g.maxLength {
+		return fmt.Errorf("string of length %v is too long", growth.Length)
+	}
+	return nil
+}
+
+func (g growthLimiter) ThrottleEnterEvaluation(interface{}) error {
+	return nil
+}
+
+func (g growthLimiter) ThrottleExitEvaluation(interface{}) {}
+
+func TestArrayGrowthThrottle(t *testing.T) {
+	m := New()
+	r := m.NewRuntime()
+	r.Throttler = growthLimiter{maxLength: 100}
+	ast, err := js.Parse(parse.NewInputString("const a = []; a[99] = 1; a[1000000000] = 1;"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Run(ast); err == nil {
+		t.Fatal("wanted an error growing the array past the limit")
+	}
+	a, err := r.Lookup("a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := len(a.(*Array).Elems); got != 100 {
+		t.Errorf("got length %v, wanted 100", got)
+	}
+	InstallStdlib(m)
+	if _, err := r.RunInteractive("Array(1e10);"); err == nil || err.Error() != "array of length 10000000000 is too long" {
+		t.Errorf("got %v, wanted the throttle to stop the allocation", err)
+	}
+	if _, err := m.NewRuntime().RunInteractive("new Array(1e10);"); reflect.TypeOf(err) != reflect.TypeOf(InvalidArrayLengthError{}) {
+		t.Errorf("got %#v, wanted an InvalidArrayLengthError", err)
+	}
+	if _, err := r.RunInteractive("Array.from({length: 1e9});"); err == nil || err.Error() != "array of length 1000000000 is too long" {
+		t.Errorf("got %v, wanted the throttle to stop the allocation", err)
+	}
+	if _, err := m.NewRuntime().RunInteractive("Array.from({length: 1e10});"); reflect.TypeOf(err) != reflect.TypeOf(InvalidArrayLengthError{}) {
+		t.Errorf("got %#v, wanted an InvalidArrayLengthError", err)
+	}
+}
+
+func TestStringGrowthThrottle(t *testing.T) {
+	for _, src := range []string{
+		"\" \".repeat(1000000000);",
+		"\" \" * 1000000000;",
+		"\"x\".padStart(1000000000);",
+		"\"x\".padEnd(1000000000, \"ab\");",
+	} {
+		r := New().NewRuntime()
+		r.Throttler = growthLimiter{maxLength: 100}
+		ast, err := js.Parse(parse.NewInputString(src))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := r.Run(ast); err == nil {
+			t.Errorf("%q: wanted an error growing the string past the limit", src)
+		}
+	}
+	// Lengths that overflow int must not wrap around into something the throttler accepts.
+	for _, src := range []string{
+		"\"ab\".repeat(4611686018427387904);",
+		"\"ab\" * 4611686018427387904;",
+	} {
+		r := New().NewRuntime()
+		r.Throttler = growthLimiter{maxLength: 100}
+		if _, err := r.RunInteractive(src); reflect.TypeOf(err) != reflect.TypeOf(InvalidCountError{}) {
+			t.Errorf("%q: got %#v, wanted an InvalidCountError", src, err)
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	if _, err := Parse("const a = 1;"); err != nil {
+		t.Fatal(err)
+	}
+	_, err := Parse("const a = 1;\nconst b = ;")
+	perr, ok := err.(ParseError)
+	if !ok {
+		t.Fatalf("got %#v, wanted a ParseError", err)
+	}
+	if perr.Line != 2 || perr.Column == 0 || perr.Context == "" {
+		t.Errorf("got %+v, wanted position info", perr)
+	}
+	if _, err := Compile("const = 1;"); err == nil {
+		t.Errorf("wanted an error")
+	} else if _, ok := err.(ParseError); !ok {
+		t.Errorf("got %#v, wanted a ParseError", err)
+	}
+}
+
+func TestFormatNumber(t *testing.T) {
+	for _, tst := range []struct {
+		n    interface{}
+		want string
+	}{
+		{3, "3"},
+		{-3, "-3"},
+		{3.0, "3"},
+		{0.5, "0.5"},
+		{1.0 / 3.0, "0.3333333333333333"},
+		{-2.25, "-2.25"},
+		{1e20, "100000000000000000000"},
+		{1e21, "1e+21"},
+		{1.5e-7, "1.5e-7"},
+		{0.000001, "0.000001"},
+		{math.NaN(), "NaN"},
+		{math.Inf(1), "Infinity"},
+		{math.Inf(-1), "-Infinity"},
+		{0.0, "0"},
+		{"3", "3"},
+	} {
+		if got := FormatNumber(tst.n); got != tst.want {
+			t.Errorf("FormatNumber(%v): got %q, wanted %q", tst.n, got, tst.want)
+		}
+	}
+}
+
+func TestMaxCallDepth(t *testing.T) {
+	m := New()
+	m.MaxCallDepth = 10
+	r := m.NewRuntime()
+	ast, err := js.Parse(parse.NewInputString("function down(n) { if (n === 0) { return 0; } else { return down(n - 1); } } down(9);"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Run(ast); err != nil {
+		t.Fatal(err)
+	}
+	ast, err = js.Parse(parse.NewInputString("down(10);"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Run(ast); reflect.TypeOf(err) != reflect.TypeOf(StackOverflowError{}) {
+		t.Fatalf("got %v, wanted a StackOverflowError", err)
+	}
+	if r.callDepth != 0 {
+		t.Errorf("got call depth %v after overflow, wanted 0", r.callDepth)
+	}
+	ast, err = js.Parse(parse.NewInputString("down(9);"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Run(ast); err != nil {
+		t.Errorf("got %v after recovering from overflow", err)
+	}
+}
+
+func TestRecoverPanics(t *testing.T) {
+	m := New()
+	m.Globals["boom"] = func() (interface{}, error) {
+		panic("boom")
+	}
+	r := m.NewRuntime()
+	_, err := r.RunInteractive("const a = 1; boom();")
+	ierr, ok := err.(InternalError)
+	if !ok {
+		t.Fatalf("got %#v, wanted an InternalError", err)
+	}
+	if ierr.Item != "boom" || !strings.Contains(ierr.Stack, "TestRecoverPanics") {
+		t.Errorf("got %+v, wanted the recovered value and a stack trace", ierr)
+	}
+	if got, err := r.RunInteractive("a + 1;"); err != nil || got != 2 {
+		t.Errorf("got %v, %v after recovering, wanted 2", got, err)
+	}
+	InstallStdlib(m)
+	r = m.NewRuntime()
+	ast, err := js.Parse(parse.NewInputString("setTimeout(() => boom(), 1);"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := r.RunContext(context.Background(), ast); reflect.TypeOf(err) != reflect.TypeOf(InternalError{}) {
+		t.Errorf("got %#v from the event loop, wanted an InternalError", err)
+	}
+}
+
+func TestInspect(t *testing.T) {
+	cyclic := map[string]interface{}{"a": 1}
+	cyclic["self"] = cyclic
+	set := &Set{}
+	for _, tst := range []struct {
+		val  interface{}
+		want string
+	}{
+		{"hi", "hi"},
+		{nil, "null"},
+		{3.0, "3"},
+		{true, "true"},
+		{[]interface{}{1, "a", nil, []interface{}{}}, `[1, "a", null, []]`},
+		{map[string]interface{}{"b": []interface{}{1, 2}, "a": 1, "2": "x", "c-d": map[string]interface{}{}}, `{"2": "x", a: 1, b: [1, 2], "c-d": {}}`},
+		{cyclic, "{a: 1, self: [Circular]}"},
+		{[]interface{}{cyclic, cyclic}, "[{a: 1, self: [Circular]}, {a: 1, self: [Circular]}]"},
+		{func() (interface{}, error) { return nil, nil }, "[Function]"},
+		{set, "Set(0) {}"},
+	} {
+		if got := Inspect(tst.val); got != tst.want {
+			t.Errorf("Inspect(%#v): got %q, wanted %q", tst.val, got, tst.want)
+		}
+	}
+	m := New()
+	InstallStdlib(m)
+	r := m.NewRuntime()
+	res, err := r.RunInteractive("const o = {b: 1, a: new Map([[\"k\", new Set([1, 2])]])}; o.c = /x/g; o;")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := Inspect(res), `{b: 1, a: Map(1) {"k" => Set(2) {1, 2}}, c: /x/g}`; got != want {
+		t.Errorf("got %q, wanted %q", got, want)
+	}
+}
+
+func TestHostValues(t *testing.T) {
+	m := New()
+	m.Globals["list"] = []interface{}{1}
+	m.Globals["sum"] = func(nums []interface{}) (interface{}, error) {
+		res := 0
+		for _, n := range nums {
+			res += n.(int)
+		}
+		return res, nil
+	}
+	res, err := m.NewRuntime().RunInteractive("list.push(2); sum(list) + sum([list.length, 3]);")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res != 8 {
+		t.Errorf("got %v, wanted 8", res)
+	}
+	m.Globals["port"] = func(config map[string]interface{}) (interface{}, error) {
+		return config["port"], nil
+	}
+	if res, err := m.NewRuntime().RunInteractive("port({host: \"localhost\", port: 8080});"); err != nil || res != 8080 {
+		t.Errorf("got %v, %v, wanted 8080", res, err)
+	}
+	m.Globals["point"] = func(args ...interface{}) (interface{}, error) {
+		return []interface{}{args[0], args[1]}, nil
+	}
+	if res, err := m.NewRuntime().RunInteractive("const p = new point(1, 2); p.push(3); p;"); err != nil || !reflect.DeepEqual(Export(res), []interface{}{1, 2, 3}) {
+		t.Errorf("got %v, %v, wanted [1 2 3]", res, err)
+	}
+	var got []interface{}
+	m.Globals["record"] = func(i interface{}) (interface{}, error) {
+		got = append(got, i)
+		return nil, nil
+	}
+	m.Globals["kind"] = RuntimeFunc(func(r *Runtime, args ...interface{}) (interface{}, error) {
+		return fmt.Sprintf("%T", args[0]), nil
+	})
+	r := m.NewRuntime()
+	if _, err := r.RunInteractive("record([1, {a: [2]}]); record(kind([]));"); err != nil {
+		t.Fatal(err)
+	}
+	if want := []interface{}{[]interface{}{1, map[string]interface{}{"a": []interface{}{2}}}, "*machine.Array"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %#v, wanted %#v", got, want)
+	}
+	if _, err := r.RunInteractive("function grow(list) { list.push(2); return list; }"); err != nil {
+		t.Fatal(err)
+	}
+	if res, err := r.Call("grow", []interface{}{1}); err != nil || !reflect.DeepEqual(res, []interface{}{1, 2}) {
+		t.Errorf("got %#v, %v, wanted [1 2]", res, err)
+	}
+	if got := m.Globals["list"].([]interface{}); len(got) != 1 {
+		t.Errorf("got %v, wanted the host global to be left alone", got)
+	}
+	if res, err := m.NewRuntime().RunInteractive("list.length;"); err != nil || res != 1 {
+		t.Errorf("got %v, %v, wanted 1", res, err)
+	}
+}
+
+func TestCollator(t *testing.T) {
+	m := New()
+	m.Collator = func(a, b string) int {
+		return strings.Compare(strings.ToLower(a), strings.ToLower(b))
+	}
+	r := m.NewRuntime()
+	res, err := r.RunInteractive("const names = [\"carol\", \"alice\", \"Bob\"]; names.sort((a, b) => a.localeCompare(b)); names;")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []interface{}{"alice", "Bob", "carol"}; !reflect.DeepEqual(Export(res), want) {
+		t.Errorf("got %v, wanted %v", res, want)
+	}
+	if res, err := r.RunInteractive("\"A\".localeCompare(\"a\");"); err != nil || res != 0 {
+		t.Errorf("got %v, %v, wanted 0", res, err)
+	}
+}
+
+func TestToJSString(t *testing.T) {
+	for _, tst := range []struct {
+		val  interface{}
+		want string
+	}{
+		{3.0, "3"},
+		{0.1, "0.1"},
+		{false, "false"},
+		{nil, "null"},
+		{[]interface{}{1, nil, "a"}, "1,,a"},
+		{map[string]interface{}{"a": 1}, "[object Object]"},
+		{func() (interface{}, error) { return "f", nil }, "function () { [native code] }"},
+	} {
+		if got := ToJSString(tst.val); got != tst.want {
+			t.Errorf("ToJSString(%#v): got %q, wanted %q", tst.val, got, tst.want)
+		}
+	}
+}
+
+func TestToNumber(t *testing.T) {
+	for _, tst := range []struct {
+		val  interface{}
+		want interface{}
+	}{
+		{"12", 12},
+		{"-12", -12},
+		{"1e3", 1000.0},
+		{".5", 0.5},
+		{"5.", 5.0},
+		{"\t7\n", 7},
+		{[]interface{}{3}, 3},
+		{[]interface{}{}, 0},
+		{false, 0},
+	} {
+		if got := ToNumber(tst.val); got != tst.want {
+			t.Errorf("ToNumber(%#v): got %#v, wanted %#v", tst.val, got, tst.want)
+		}
+	}
+	for _, val := range []interface{}{"abc", "1a", "inf", "NaN", "1_000", "0x", "--1", map[string]interface{}{}, []interface{}{1, 2}} {
+		if got, ok := ToNumber(val).(float64); !ok || !math.IsNaN(got) {
+			t.Errorf("ToNumber(%#v): got %#v, wanted NaN", val, ToNumber(val))
+		}
+	}
+}
+
+func TestParseIntFloat(t *testing.T) {
+	for _, tst := range []struct {
+		parse func(...interface{}) (interface{}, error)
+		args  []interface{}
+		want  interface{}
+	}{
+		{ParseInt, []interface{}{"42px"}, 42},
+		{ParseInt, []interface{}{"  -17", 10}, -17},
+		{ParseInt, []interface{}{"0x1f"}, 31},
+		{ParseInt, []interface{}{"1f", 16}, 31},
+		{ParseInt, []interface{}{"0x1f", 16}, 31},
+		{ParseInt, []interface{}{"0x1f", 10}, 0},
+		{ParseInt, []interface{}{"101", 2}, 5},
+		{ParseInt, []interface{}{"zz", 36}, 1295},
+		{ParseInt, []interface{}{"3.9"}, 3},
+		{ParseInt, []interface{}{15.99}, 15},
+		{ParseInt, []interface{}{"123", 0}, 123},
+		{ParseFloat, []interface{}{"3.14abc"}, 3.14},
+		{ParseFloat, []interface{}{" 42px"}, 42},
+		{ParseFloat, []interface{}{"-.5e1x"}, -5},
+		{ParseFloat, []interface{}{"1.5e"}, 1.5},
+		{ParseFloat, []interface{}{"-Infinityx"}, math.Inf(-1)},
+		{ParseFloat, []interface{}{2.5}, 2.5},
+	} {
+		if got, err := tst.parse(tst.args...); err != nil || got != tst.want {
+			t.Errorf("%v: got %#v, %v, wanted %#v", tst.args, got, err, tst.want)
+		}
+	}
+	for _, tst := range []struct {
+		parse func(...interface{}) (interface{}, error)
+		args  []interface{}
+	}{
+		{ParseInt, []interface{}{""}},
+		{ParseInt, []interface{}{"px"}},
+		{ParseInt, []interface{}{"0x"}},
+		{ParseInt, []interface{}{"12", 1}},
+		{ParseInt, []interface{}{"12", 37}},
+		{ParseInt, []interface{}{"2", 2}},
+		{ParseInt, []interface{}{}},
+		{ParseFloat, []interface{}{""}},
+		{ParseFloat, []interface{}{".e1"}},
+		{ParseFloat, []interface{}{"inf"}},
+	} {
+		if got, err := tst.parse(tst.args...); err != nil || !math.IsNaN(got.(float64)) {
+			t.Errorf("%v: got %#v, %v, wanted NaN", tst.args, got, err)
+		}
+	}
+}
+
+func TestNotCallableCallee(t *testing.T) {
+	for _, tst := range []struct {
+		src    string
+		callee string
+	}{
+		{"const foo = 5; foo();", "foo"},
+		{"const o = {a: {b: 1}}; o.a.b();", "b"},
+		{"const a = [1]; a[0]();", "a[0]"},
+	} {
+		_, err := New().NewRuntime().RunInteractive(tst.src)
+		nerr, ok := err.(NotCallableError)
+		if !ok {
+			t.Errorf("%q: got %#v, wanted a NotCallableError", tst.src, err)
+			continue
+		}
+		if !strings.Contains(nerr.Callee, tst.callee) || !strings.Contains(nerr.Error(), nerr.Callee) {
+			t.Errorf("%q: got %+v, wanted the callee %q in the error", tst.src, nerr, tst.callee)
+		}
+	}
+}
+
+func TestObjectAssignHostMaps(t *testing.T) {
+	m := New()
+	InstallStdlib(m)
+	defaults := map[string]interface{}{"port": 80, "host": "localhost"}
+	target := map[string]interface{}{}
+	m.Globals["defaults"] = defaults
+	m.Globals["target"] = target
+	r := m.NewRuntime()
+	res, err := r.RunInteractive("const config = Object.assign({}, defaults, null, {port: 8080}); Object.assign(target, config); config;")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]interface{}{"port": 8080, "host": "localhost"}
+	if !reflect.DeepEqual(Export(res), want) {
+		t.Errorf("got %v, wanted %v", res, want)
+	}
+	if !reflect.DeepEqual(target, want) {
+		t.Errorf("got host target %v, wanted %v", target, want)
+	}
+	if defaults["port"] != 80 {
+		t.Errorf("host source was mutated: %v", defaults)
+	}
+}
+
+func TestFreezeHostMaps(t *testing.T) {
+	m := New()
+	InstallStdlib(m)
+	cfg := map[string]interface{}{"a": 1}
+	m.Globals["cfg"] = cfg
+	r := m.NewRuntime()
+	for _, src := range []string{"cfg.a = 2;", "cfg[\"b\"] = 2;", "delete cfg.a;", "Object.assign(cfg, {a: 2});"} {
+		if _, err := r.RunInteractive("Object.freeze(cfg); " + src); reflect.TypeOf(err) != reflect.TypeOf(FrozenObjectError{}) {
+			t.Errorf("%q: got %v, wanted a FrozenObjectError", src, err)
+		}
+	}
+	if res, err := r.RunInteractive("Object.isFrozen(cfg);"); err != nil || res != true {
+		t.Errorf("got %v, %v, wanted true", res, err)
+	}
+	if cfg["a"] != 1 || len(cfg) != 1 {
+		t.Errorf("frozen host map was mutated: %v", cfg)
+	}
+	if res, err := m.NewRuntime().RunInteractive("Object.isFrozen(cfg);"); err != nil || res != false {
+		t.Errorf("got %v, %v, wanted the map to stay unfrozen in other runtimes", res, err)
+	}
+	r.Reset()
+	if _, err := r.RunInteractive("cfg.a = 2;"); err != nil || cfg["a"] != 2 {
+		t.Errorf("got %v, %v, wanted the map to be unfrozen after Reset", cfg, err)
+	}
+}
+
+func TestStdlibNamespacesPerRuntime(t *testing.T) {
+	m := New()
+	InstallStdlib(m)
+	sandboxed := m.NewSandboxedRuntime("Math", "JSON")
+	if _, err := sandboxed.RunInteractive("Math.PI = 3; JSON.parse = null;"); err != nil {
+		t.Fatal(err)
+	}
+	r := m.NewRuntime()
+	if res, err := r.RunInteractive("Object.keys = null; Math.PI;"); err != nil || res != math.Pi {
+		t.Errorf("got %v, %v, wanted Math.PI to be untouched by other runtimes", res, err)
+	}
+	if res, err := m.NewRuntime().RunInteractive("JSON.parse(\"1\") + Object.keys({a: 1}).length;"); err != nil || res != 2 {
+		t.Errorf("got %v, %v, wanted 2", res, err)
+	}
+	if res, err := sandboxed.RunInteractive("Math.PI;"); err != nil || res != 3 {
+		t.Errorf("got %v, %v, wanted the runtime to keep its own changes", res, err)
+	}
+	sandboxed.Reset()
+	if res, err := sandboxed.RunInteractive("Math.PI;"); err != nil || res != math.Pi {
+		t.Errorf("got %v, %v, wanted Reset to restore Math.PI", res, err)
+	}
+}
+
+func TestParseJSONOffset(t *testing.T) {
+	r := New().NewRuntime()
+	_, err := r.ParseJSON(`{"a": 1, "b": x}`)
+	jerr, ok := err.(JSONSyntaxError)
+	if !ok {
+		t.Fatalf("got %#v, wanted a JSONSyntaxError", err)
+	}
+	if jerr.Offset != 15 {
+		t.Errorf("got offset %v, wanted 15", jerr.Offset)
+	}
+}
+
+func TestModuleResolverFunc(t *testing.T) {
+	sources := map[string]string{
+		"lib/counter.js": "import {step} from \"./step.js\"; export const next = (n) => n + step;",
+		"lib/step.js":    "export const step = 2;",
+	}
+	resolved := map[string]int{}
+	m := New()
+	m.ModuleLoader = ResolverFunc(func(specifier string) (*js.AST, error) {
+		resolved[specifier]++
+		src, found := sources[specifier]
+		if !found {
+			return nil, nil
+		}
+		return Parse(src)
+	})
+	resp := []interface{}{}
+	m.Globals["out"] = func(i interface{}) (interface{}, error) {
+		resp = append(resp, i)
+		return nil, nil
+	}
+	r := m.NewRuntime()
+	if _, err := r.RunInteractive("import {next} from \"lib/counter.js\"; import {step} from \"lib/step.js\"; out(next(1)); out(step);"); err != nil {
+		t.Fatal(err)
+	}
+	if want := []interface{}{3, 2}; !reflect.DeepEqual(resp, want) {
+		t.Errorf("got %v, wanted %v", resp, want)
+	}
+	if want := map[string]int{"lib/counter.js": 1, "lib/step.js": 1}; !reflect.DeepEqual(resolved, want) {
+		t.Errorf("resolved %v, wanted each module once: %v", resolved, want)
+	}
+	if _, err := r.RunInteractive("import {x} from \"missing.js\";"); reflect.TypeOf(err) != reflect.TypeOf(ModuleNotFoundError{}) {
+		t.Errorf("got %#v, wanted a ModuleNotFoundError", err)
+	}
+}
+
+func TestRuntimeExports(t *testing.T) {
+	m := New()
+	r := m.NewRuntime()
+	if _, err := r.RunInteractive("const hidden = 1; export const x = hidden + 1; export function double(n) { return n * 2; } let y = 3; export {y as why}; export default \"main\";"); err != nil {
+		t.Fatal(err)
+	}
+	if r.Exports["x"] != 2 || r.Exports["why"] != 3 || r.Exports[DefaultExport] != "main" {
+		t.Errorf("got %v, wanted x, why and the default export", r.Exports)
+	}
+	if _, found := r.Exports["hidden"]; found {
+		t.Errorf("got %v, didn't want unexported bindings", r.Exports)
+	}
+	res, err := r.call(r.Exports["double"], []interface{}{4})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res != 8 {
+		t.Errorf("got %v, wanted 8", res)
+	}
+}
+
+func TestRunCells(t *testing.T) {
+	m := New()
+	r := m.NewRuntime()
+	cells, err := r.RunCells("let x = 1; x + 1; missing(); x = x + 2; x;")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cells) != 5 {
+		t.Fatalf("got %v cells, wanted 5", len(cells))
+	}
+	for idx, cell := range cells {
+		if idx == 2 {
+			if _, ok := cell.Err.(NotDeclaredError); !ok {
+				t.Errorf("got %#v for cell %v, wanted a NotDeclaredError", cell.Err, idx)
+			}
+		} else if cell.Err != nil {
+			t.Errorf("got %v for cell %v", cell.Err, idx)
+		}
+	}
+	if cells[1].Value != 2 || cells[4].Value != 3 {
+		t.Errorf("got %v and %v, wanted 2 and 3", cells[1].Value, cells[4].Value)
+	}
+	if _, err := r.RunCells("let ="); reflect.TypeOf(err) != reflect.TypeOf(ParseError{}) {
+		t.Errorf("got %#v, wanted a ParseError", err)
 	}
 }
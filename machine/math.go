@@ -0,0 +1,117 @@
+package machine
+
+import (
+	"math"
+)
+
+// numberArgs converts args to floats, and reports whether they were all ints to begin with.
+func numberArgs(args []interface{}) ([]float64, bool) {
+	res := make([]float64, len(args))
+	ints := true
+	for idx, arg := range args {
+		n := ToNumber(arg)
+		if _, ok := n.(int); !ok {
+			ints = false
+		}
+		res[idx] = toFloat(n)
+	}
+	return res, ints
+}
+
+// integral returns f as an int if it is a whole number within the safe integer range.
+func integral(f float64) (int, bool) {
+	if math.IsNaN(f) || math.IsInf(f, 0) || f != math.Trunc(f) || math.Abs(f) > maxSafeInteger {
+		return 0, false
+	}
+	return int(f), true
+}
+
+// mathResult keeps results of integer inputs as ints when they are integral.
+func mathResult(f float64, ints bool) interface{} {
+	if ints {
+		if i, ok := integral(f); ok {
+			return i
+		}
+	}
+	return f
+}
+
+// unaryMath wraps f as a JS function of one argument, where missing arguments are NaN.
+func unaryMath(f func(float64) float64, alwaysInt bool) Func {
+	return func(args ...interface{}) (interface{}, error) {
+		if len(args) == 0 {
+			return math.NaN(), nil
+		}
+		nums, ints := numberArgs(args[:1])
+		return mathResult(f(nums[0]), ints || alwaysInt), nil
+	}
+}
+
+func extremum(args []interface{}, empty float64, better func(a, b float64) bool) interface{} {
+	nums, ints := numberArgs(args)
+	res := empty
+	for _, n := range nums {
+		if math.IsNaN(n) {
+			return math.NaN()
+		}
+		if better(n, res) {
+			res = n
+		}
+	}
+	if len(nums) == 0 {
+		return res
+	}
+	return mathResult(res, ints)
+}
+
+func jsRound(f float64) float64 {
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return f
+	}
+	return math.Floor(f + 0.5)
+}
+
+func jsSign(f float64) float64 {
+	switch {
+	case f > 0:
+		return 1
+	case f < 0:
+		return -1
+	}
+	return f
+}
+
+var mathProperties = map[string]interface{}{
+	"PI":    math.Pi,
+	"E":     math.E,
+	"floor": unaryMath(math.Floor, true),
+	"ceil":  unaryMath(math.Ceil, true),
+	"round": unaryMath(jsRound, true),
+	"trunc": unaryMath(math.Trunc, true),
+	"abs":   unaryMath(math.Abs, false),
+	"sign":  unaryMath(jsSign, false),
+	"sqrt":  unaryMath(math.Sqrt, false),
+	"log":   unaryMath(math.Log, false),
+	"exp":   unaryMath(math.Exp, false),
+	"min": func(args ...interface{}) (interface{}, error) {
+		return extremum(args, math.Inf(1), func(a, b float64) bool { return a < b }), nil
+	},
+	"max": func(args ...interface{}) (interface{}, error) {
+		return extremum(args, math.Inf(-1), func(a, b float64) bool { return a > b }), nil
+	},
+	"pow": func(args ...interface{}) (interface{}, error) {
+		nums, ints := numberArgs(args)
+		if len(nums) < 2 {
+			return math.NaN(), nil
+		}
+		return mathResult(math.Pow(nums[0], nums[1]), ints), nil
+	},
+	"hypot": func(args ...interface{}) (interface{}, error) {
+		nums, ints := numberArgs(args)
+		res := 0.0
+		for _, n := range nums {
+			res = math.Hypot(res, n)
+		}
+		return mathResult(res, ints), nil
+	},
+}
@@ -0,0 +1,372 @@
+package machine
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/tdewolff/parse/v2/js"
+	"github.com/zond/gojuice/scope"
+)
+
+type ModuleNotFoundError struct {
+	Message string
+	Item    interface{}
+}
+
+func (m ModuleNotFoundError) Error() string {
+	return m.Message
+}
+
+type CyclicImportError struct {
+	Message string
+	Item    interface{}
+}
+
+func (c CyclicImportError) Error() string {
+	return c.Message
+}
+
+type ExportNotFoundError struct {
+	Message string
+	Item    interface{}
+}
+
+func (e ExportNotFoundError) Error() string {
+	return e.Message
+}
+
+// DefaultExport is the namespace key of `export default` values.
+const DefaultExport = "default"
+
+type ModuleLoader interface {
+	Resolve(specifier, referrer string) (string, error)
+	Load(path string) (string, error)
+}
+
+func isRelativeSpecifier(specifier string) bool {
+	return strings.HasPrefix(specifier, "./") || strings.HasPrefix(specifier, "../")
+}
+
+type MapLoader map[string]string
+
+func (m MapLoader) Resolve(specifier, referrer string) (string, error) {
+	if isRelativeSpecifier(specifier) {
+		return path.Join(path.Dir(referrer), specifier), nil
+	}
+	return path.Clean(specifier), nil
+}
+
+func (m MapLoader) Load(p string) (string, error) {
+	src, found := m[p]
+	if !found {
+		return "", ModuleNotFoundError{
+			Message: fmt.Sprintf("module %q not found", p),
+			Item:    p,
+		}
+	}
+	return src, nil
+}
+
+type ASTLoader interface {
+	LoadAST(path string) (*js.AST, error)
+}
+
+// ResolverFunc lets hosts provide already parsed modules, resolving relative specifiers like MapLoader.
+type ResolverFunc func(specifier string) (*js.AST, error)
+
+func (f ResolverFunc) Resolve(specifier, referrer string) (string, error) {
+	return MapLoader(nil).Resolve(specifier, referrer)
+}
+
+func (f ResolverFunc) Load(p string) (string, error) {
+	return "", NotImplementedError{
+		Message: fmt.Sprintf("ResolverFunc can't load the source of %q, only its AST", p),
+		Item:    p,
+	}
+}
+
+func (f ResolverFunc) LoadAST(p string) (*js.AST, error) {
+	ast, err := f(p)
+	if err == nil && ast == nil {
+		err = ModuleNotFoundError{
+			Message: fmt.Sprintf("module %q not found", p),
+			Item:    p,
+		}
+	}
+	return ast, err
+}
+
+type FSLoader struct {
+	Dir string
+}
+
+// Resolve refuses paths outside of Dir, so that scripts can't read arbitrary files.
+func (f FSLoader) Resolve(specifier, referrer string) (string, error) {
+	p := filepath.Join(f.Dir, filepath.FromSlash(specifier))
+	if isRelativeSpecifier(specifier) && referrer != "" {
+		p = filepath.Join(filepath.Dir(referrer), filepath.FromSlash(specifier))
+	}
+	rel, err := filepath.Rel(filepath.Clean(f.Dir), p)
+	if err != nil || filepath.IsAbs(rel) || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", ModuleNotFoundError{
+			Message: fmt.Sprintf("module %q resolves outside of %q", specifier, f.Dir),
+			Item:    specifier,
+		}
+	}
+	return p, nil
+}
+
+func (f FSLoader) Load(p string) (string, error) {
+	b, err := ioutil.ReadFile(p)
+	if err != nil {
+		return "", ModuleNotFoundError{
+			Message: fmt.Sprintf("module %q not found: %v", p, err),
+			Item:    p,
+		}
+	}
+	return string(b), nil
+}
+
+type module struct {
+	path      string
+	namespace map[string]interface{}
+	exports   map[string]string
+	loading   bool
+}
+
+func (r *Runtime) importModule(specifier, referrer string) (map[string]interface{}, error) {
+	if r.M.ModuleLoader == nil {
+		return nil, ModuleNotFoundError{
+			Message: fmt.Sprintf("can't import %q without a module loader", specifier),
+			Item:    specifier,
+		}
+	}
+	p, err := r.M.ModuleLoader.Resolve(specifier, referrer)
+	if err != nil {
+		return nil, err
+	}
+	if mod, found := r.modules[p]; found {
+		if mod.loading {
+			return nil, CyclicImportError{
+				Message: fmt.Sprintf("%q is imported cyclically from %q", p, referrer),
+				Item:    p,
+			}
+		}
+		return mod.namespace, nil
+	}
+	ast, err := r.loadModule(p)
+	if err != nil {
+		return nil, err
+	}
+	mod := &module{
+		path:      p,
+		namespace: map[string]interface{}{},
+		exports:   map[string]string{},
+		loading:   true,
+	}
+	if r.modules == nil {
+		r.modules = map[string]*module{}
+	}
+	r.modules[p] = mod
+	parentScope := r.Scope
+	r.Scope = scope.New(nil)
+	defer func() {
+		r.Scope = parentScope
+	}()
+	evaluator := &Evaluator{Runtime: r, module: mod}
+	if _, err := evaluator.EvalBlockStmt(&ast.BlockStmt, false); err != nil {
+		delete(r.modules, p)
+		return nil, err
+	}
+	for exported, local := range mod.exports {
+		val, err := r.Lookup(local)
+		if err != nil {
+			delete(r.modules, p)
+			return nil, err
+		}
+		mod.namespace[exported] = val
+	}
+	mod.loading = false
+	return mod.namespace, nil
+}
+
+func (r *Runtime) collectExports(mod *module) error {
+	if len(mod.namespace) == 0 && len(mod.exports) == 0 {
+		return nil
+	}
+	if r.Exports == nil {
+		r.Exports = map[string]interface{}{}
+	}
+	for exported, val := range mod.namespace {
+		r.Exports[exported] = val
+	}
+	for exported, local := range mod.exports {
+		val, err := r.Lookup(local)
+		if err != nil {
+			return err
+		}
+		r.Exports[exported] = val
+	}
+	return nil
+}
+
+func (r *Runtime) loadModule(p string) (*js.AST, error) {
+	if loader, ok := r.M.ModuleLoader.(ASTLoader); ok {
+		return loader.LoadAST(p)
+	}
+	src, err := r.M.ModuleLoader.Load(p)
+	if err != nil {
+		return nil, err
+	}
+	return Parse(src)
+}
+
+func (e *Evaluator) referrer() string {
+	if e.module == nil {
+		return ""
+	}
+	return e.module.path
+}
+
+func moduleSpecifier(b []byte) string {
+	return string(b[1 : len(b)-1])
+}
+
+func (e *Evaluator) EvalImportStmt(stmt *js.ImportStmt) (interface{}, error) {
+	specifier := moduleSpecifier(stmt.Module)
+	namespace, err := e.Runtime.importModule(specifier, e.referrer())
+	if err != nil {
+		return nil, err
+	}
+	bind := func(exported, local string) error {
+		val, found := namespace[exported]
+		if !found {
+			return ExportNotFoundError{
+				Message: fmt.Sprintf("%q doesn't export %q", specifier, exported),
+				Item:    exported,
+			}
+		}
+		return e.Runtime.Scope.Set(local, &scope.Binding{
+			Item:     val,
+			Constant: true,
+		})
+	}
+	if stmt.Default != nil {
+		if err := bind(DefaultExport, string(stmt.Default)); err != nil {
+			return nil, err
+		}
+	}
+	for _, alias := range stmt.List {
+		if alias.Binding == nil {
+			continue
+		}
+		if string(alias.Name) == "*" {
+			if err := e.Runtime.Scope.Set(string(alias.Binding), &scope.Binding{
+				Item:     namespace,
+				Constant: true,
+			}); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		exported := string(alias.Binding)
+		if alias.Name != nil {
+			exported = string(alias.Name)
+		}
+		if err := bind(exported, string(alias.Binding)); err != nil {
+			return nil, err
+		}
+	}
+	return nil, nil
+}
+
+func declaredNames(decl js.IExpr) []string {
+	switch v := decl.(type) {
+	case *js.VarDecl:
+		res := []string{}
+		for _, el := range v.List {
+			if bind, ok := el.Binding.(*js.Var); ok {
+				res = append(res, string(bind.Data))
+			}
+		}
+		return res
+	case *js.FuncDecl:
+		if v.Name != nil {
+			return []string{string(v.Name.Data)}
+		}
+	case *js.ClassDecl:
+		if v.Name != nil {
+			return []string{string(v.Name.Data)}
+		}
+	}
+	return nil
+}
+
+func (e *Evaluator) EvalExportStmt(stmt *js.ExportStmt) (interface{}, error) {
+	if stmt.Decl != nil {
+		val, err := e.Eval(stmt.Decl)
+		if err != nil {
+			return nil, err
+		}
+		if e.module != nil {
+			if stmt.Default {
+				e.module.namespace[DefaultExport] = val
+			} else {
+				for _, name := range declaredNames(stmt.Decl) {
+					e.module.exports[name] = name
+				}
+			}
+		}
+		return val, nil
+	}
+	if e.module == nil {
+		return nil, nil
+	}
+	if stmt.Module != nil {
+		namespace, err := e.Runtime.importModule(moduleSpecifier(stmt.Module), e.referrer())
+		if err != nil {
+			return nil, err
+		}
+		for _, alias := range stmt.List {
+			switch {
+			case alias.Binding == nil:
+			case alias.Name == nil && string(alias.Binding) == "*":
+				for k, v := range namespace {
+					if k != DefaultExport {
+						e.module.namespace[k] = v
+					}
+				}
+			case string(alias.Name) == "*":
+				e.module.namespace[string(alias.Binding)] = namespace
+			default:
+				imported := string(alias.Binding)
+				if alias.Name != nil {
+					imported = string(alias.Name)
+				}
+				val, found := namespace[imported]
+				if !found {
+					return nil, ExportNotFoundError{
+						Message: fmt.Sprintf("%q doesn't export %q", moduleSpecifier(stmt.Module), imported),
+						Item:    imported,
+					}
+				}
+				e.module.namespace[string(alias.Binding)] = val
+			}
+		}
+		return nil, nil
+	}
+	for _, alias := range stmt.List {
+		if alias.Binding == nil {
+			continue
+		}
+		local := string(alias.Binding)
+		if alias.Name != nil {
+			local = string(alias.Name)
+		}
+		e.module.exports[string(alias.Binding)] = local
+	}
+	return nil, nil
+}
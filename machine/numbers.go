@@ -0,0 +1,189 @@
+package machine
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// FormatNumber formats numbers the way JS prints them, so that 3.0 becomes "3" and 1e21 becomes "1e+21".
+func FormatNumber(i interface{}) string {
+	switch v := i.(type) {
+	case int:
+		return strconv.Itoa(v)
+	case float64:
+		switch {
+		case math.IsNaN(v):
+			return "NaN"
+		case math.IsInf(v, 1):
+			return "Infinity"
+		case math.IsInf(v, -1):
+			return "-Infinity"
+		case v == 0:
+			return "0"
+		}
+		if abs := math.Abs(v); abs >= 1e21 || abs < 1e-6 {
+			res := strconv.FormatFloat(v, 'e', -1, 64)
+			mantissa, exponent := res[:strings.Index(res, "e")], res[strings.Index(res, "e")+1:]
+			sign, digits := exponent[:1], strings.TrimLeft(exponent[1:], "0")
+			return mantissa + "e" + sign + digits
+		}
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	}
+	return fmt.Sprint(i)
+}
+
+var numericString = regexp.MustCompile(`^[+-]?(Infinity|\d+\.?\d*([eE][+-]?\d+)?|\.\d+([eE][+-]?\d+)?)$`)
+
+// ToNumber converts values to numbers like JS Number(x) does, keeping integral results ints where the input was.
+func ToNumber(i interface{}) interface{} {
+	switch v := i.(type) {
+	case nil:
+		return 0
+	case int, float64:
+		return v
+	case bool:
+		if v {
+			return 1
+		}
+		return 0
+	case string:
+		s := strings.TrimFunc(v, isJSWhitespace)
+		if s == "" {
+			return 0
+		}
+		if n, err := strconv.Atoi(s); err == nil {
+			return n
+		}
+		if strings.HasPrefix(s, "0x") || strings.HasPrefix(s, "0X") {
+			if n, err := strconv.ParseInt(s[2:], 16, 64); err == nil {
+				return int(n)
+			}
+			return math.NaN()
+		}
+		if !numericString.MatchString(s) {
+			return math.NaN()
+		}
+		switch strings.TrimLeft(s, "+-") {
+		case "Infinity":
+			if strings.HasPrefix(s, "-") {
+				return math.Inf(-1)
+			}
+			return math.Inf(1)
+		}
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return math.NaN()
+		}
+		return f
+	case *Array:
+		return ToNumber(Join(v.Elems, ","))
+	case []interface{}:
+		return ToNumber(Join(v, ","))
+	}
+	return math.NaN()
+}
+
+func toFloat(i interface{}) float64 {
+	switch v := ToNumber(i).(type) {
+	case int:
+		return float64(v)
+	case float64:
+		return v
+	}
+	return math.NaN()
+}
+
+// ToInt32 converts like the JS bitwise operators do, wrapping modulo 2^32 and treating NaN and Infinity as 0.
+func ToInt32(i interface{}) int32 {
+	switch v := ToNumber(i).(type) {
+	case int:
+		return int32(v)
+	case float64:
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return 0
+		}
+		return int32(uint32(int64(math.Mod(math.Trunc(v), 1<<32))))
+	}
+	return 0
+}
+
+var floatPrefix = regexp.MustCompile(`^[+-]?(Infinity|(\d+\.?\d*|\.\d+)([eE][+-]?\d+)?)`)
+
+// ParseFloat parses the longest leading decimal number of the stringified argument, like parseFloat.
+func ParseFloat(args ...interface{}) (interface{}, error) {
+	s := ""
+	if len(args) > 0 {
+		s = strings.TrimLeftFunc(ToJSString(args[0]), unicode.IsSpace)
+	}
+	prefix := floatPrefix.FindString(s)
+	switch strings.TrimLeft(prefix, "+-") {
+	case "":
+		return math.NaN(), nil
+	case "Infinity":
+		if prefix[0] == '-' {
+			return math.Inf(-1), nil
+		}
+		return math.Inf(1), nil
+	}
+	return parseNumberLiteral(prefix)
+}
+
+// ParseInt parses the leading digits of the stringified argument in the given radix, like parseInt.
+func ParseInt(args ...interface{}) (interface{}, error) {
+	s := ""
+	if len(args) > 0 {
+		s = strings.TrimLeftFunc(ToJSString(args[0]), unicode.IsSpace)
+	}
+	radix := 0
+	if len(args) > 1 {
+		radix = int(ToInt32(args[1]))
+	}
+	sign := 1.0
+	if s != "" && (s[0] == '-' || s[0] == '+') {
+		if s[0] == '-' {
+			sign = -1
+		}
+		s = s[1:]
+	}
+	if radix == 0 || radix == 16 {
+		if strings.HasPrefix(s, "0x") || strings.HasPrefix(s, "0X") {
+			s = s[2:]
+			radix = 16
+		}
+	}
+	if radix == 0 {
+		radix = 10
+	}
+	if radix < 2 || radix > 36 {
+		return math.NaN(), nil
+	}
+	res := 0.0
+	digits := 0
+	for _, c := range s {
+		digit := 36
+		switch {
+		case c >= '0' && c <= '9':
+			digit = int(c - '0')
+		case c >= 'a' && c <= 'z':
+			digit = int(c-'a') + 10
+		case c >= 'A' && c <= 'Z':
+			digit = int(c-'A') + 10
+		}
+		if digit >= radix {
+			break
+		}
+		res = res*float64(radix) + float64(digit)
+		digits++
+	}
+	if digits == 0 {
+		return math.NaN(), nil
+	}
+	if i, ok := integral(sign * res); ok {
+		return i, nil
+	}
+	return sign * res, nil
+}
@@ -0,0 +1,155 @@
+package machine
+
+import (
+	"sort"
+	"strconv"
+)
+
+// OrderedMap is an object created by a script. It remembers the order its keys were added in, so that they can be listed like JS does.
+type OrderedMap struct {
+	keys   []string
+	values map[string]interface{}
+	frozen bool
+}
+
+func NewOrderedMap() *OrderedMap {
+	return &OrderedMap{
+		values: map[string]interface{}{},
+	}
+}
+
+func (o *OrderedMap) Get(key string) (interface{}, bool) {
+	val, found := o.values[key]
+	return val, found
+}
+
+func (o *OrderedMap) Set(key string, value interface{}) {
+	if _, found := o.values[key]; !found {
+		o.keys = append(o.keys, key)
+	}
+	o.values[key] = value
+}
+
+func (o *OrderedMap) Delete(key string) bool {
+	if _, found := o.values[key]; !found {
+		return false
+	}
+	delete(o.values, key)
+	for idx, k := range o.keys {
+		if k == key {
+			o.keys = append(o.keys[:idx], o.keys[idx+1:]...)
+			break
+		}
+	}
+	return true
+}
+
+// copy is shallow, and leaves the copy unfrozen.
+func (o *OrderedMap) copy() *OrderedMap {
+	res := &OrderedMap{
+		keys:   append([]string{}, o.keys...),
+		values: make(map[string]interface{}, len(o.values)),
+	}
+	for k, v := range o.values {
+		res.values[k] = v
+	}
+	return res
+}
+
+func (o *OrderedMap) Len() int {
+	return len(o.keys)
+}
+
+// Keys returns integer keys in ascending order followed by the other keys in insertion order, leaving out symbol keys.
+func (o *OrderedMap) Keys() []string {
+	indices, names := []string{}, []string{}
+	for _, key := range o.keys {
+		if isSymbolKey(key) {
+			continue
+		}
+		if _, ok := isArrayIndex(key); ok {
+			indices = append(indices, key)
+		} else {
+			names = append(names, key)
+		}
+	}
+	sortKeys(indices)
+	return append(indices, names...)
+}
+
+// object is what the evaluator needs from objects, which are either OrderedMaps from scripts or plain maps from the host.
+type object interface {
+	Get(key string) (interface{}, bool)
+	Set(key string, value interface{})
+	Delete(key string) bool
+	Len() int
+	Keys() []string
+}
+
+// hostObject lists its keys sorted, since plain maps don't know the order they were filled in.
+type hostObject map[string]interface{}
+
+func (h hostObject) Get(key string) (interface{}, bool) {
+	val, found := h[key]
+	return val, found
+}
+
+func (h hostObject) Set(key string, value interface{}) {
+	h[key] = value
+}
+
+func (h hostObject) Delete(key string) bool {
+	if _, found := h[key]; !found {
+		return false
+	}
+	delete(h, key)
+	return true
+}
+
+func (h hostObject) Len() int {
+	return len(h)
+}
+
+func (h hostObject) Keys() []string {
+	return sortedKeys(h)
+}
+
+func asObject(i interface{}) (object, bool) {
+	switch v := i.(type) {
+	case *OrderedMap:
+		return v, true
+	case map[string]interface{}:
+		return hostObject(v), true
+	}
+	return nil, false
+}
+
+func isArrayIndex(key string) (int, bool) {
+	idx, err := strconv.Atoi(key)
+	return idx, err == nil && idx >= 0 && strconv.Itoa(idx) == key
+}
+
+func sortKeys(keys []string) {
+	sort.SliceStable(keys, func(i, j int) bool {
+		idxI, okI := isArrayIndex(keys[i])
+		idxJ, okJ := isArrayIndex(keys[j])
+		if okI && okJ {
+			return idxI < idxJ
+		}
+		if okI != okJ {
+			return okI
+		}
+		return keys[i] < keys[j]
+	})
+}
+
+func sortedKeys(obj map[string]interface{}) []string {
+	res := make([]string, 0, len(obj))
+	for key := range obj {
+		if !isSymbolKey(key) {
+			res = append(res, key)
+		}
+	}
+	sortKeys(res)
+	return res
+}
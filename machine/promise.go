@@ -0,0 +1,205 @@
+package machine
+
+import (
+	"fmt"
+
+	"github.com/tdewolff/parse/v2/js"
+)
+
+type promiseState int
+
+const (
+	pending promiseState = iota
+	fulfilled
+	rejected
+)
+
+type Promise struct {
+	state    promiseState
+	value    interface{}
+	handlers []func()
+}
+
+func NewPromise() *Promise {
+	return &Promise{}
+}
+
+func (p *Promise) settle(state promiseState, value interface{}) {
+	if p.state != pending {
+		return
+	}
+	p.state = state
+	p.value = value
+	handlers := p.handlers
+	p.handlers = nil
+	for _, handler := range handlers {
+		handler()
+	}
+}
+
+func (p *Promise) Resolve(value interface{}) {
+	if other, ok := value.(*Promise); ok {
+		other.onSettled(func() {
+			p.settle(other.state, other.value)
+		})
+		return
+	}
+	p.settle(fulfilled, value)
+}
+
+func (p *Promise) Reject(reason interface{}) {
+	p.settle(rejected, reason)
+}
+
+func (p *Promise) onSettled(handler func()) {
+	if p.state == pending {
+		p.handlers = append(p.handlers, handler)
+	} else {
+		handler()
+	}
+}
+
+func (p *Promise) Then(onFulfilled, onRejected interface{}) *Promise {
+	res := NewPromise()
+	p.onSettled(func() {
+		handler := onFulfilled
+		if p.state == rejected {
+			handler = onRejected
+		}
+		if handler == nil {
+			res.settle(p.state, p.value)
+			return
+		}
+		val, err := Call(handler, []interface{}{p.value})
+		if err != nil {
+			res.Reject(err)
+			return
+		}
+		res.Resolve(val)
+	})
+	return res
+}
+
+func PromiseConstructor(r *Runtime, args ...interface{}) (interface{}, error) {
+	if len(args) == 0 {
+		return nil, WrongNumberOfArgsError{
+			Message: "Promise takes 1 arg, got 0",
+			Item:    args,
+			Got:     0,
+			Want:    1,
+		}
+	}
+	res := NewPromise()
+	resolve := func(args ...interface{}) (interface{}, error) {
+		var value interface{}
+		if len(args) > 0 {
+			value = args[0]
+		}
+		res.Resolve(value)
+		return nil, nil
+	}
+	reject := func(args ...interface{}) (interface{}, error) {
+		var reason interface{}
+		if len(args) > 0 {
+			reason = args[0]
+		}
+		res.Reject(reason)
+		return nil, nil
+	}
+	if _, err := r.call(args[0], []interface{}{resolve, reject}); err != nil {
+		res.Reject(err)
+	}
+	return res, nil
+}
+
+func PromiseResolve(value interface{}) (interface{}, error) {
+	if p, ok := value.(*Promise); ok {
+		return p, nil
+	}
+	res := NewPromise()
+	res.Resolve(value)
+	return res, nil
+}
+
+func PromiseReject(reason interface{}) (interface{}, error) {
+	res := NewPromise()
+	res.Reject(reason)
+	return res, nil
+}
+
+func PromiseAll(values []interface{}) (interface{}, error) {
+	res := NewPromise()
+	results := make([]interface{}, len(values))
+	remaining := len(values)
+	if remaining == 0 {
+		res.Resolve(&Array{Elems: results})
+		return res, nil
+	}
+	for idx, value := range values {
+		idx := idx
+		p, ok := value.(*Promise)
+		if !ok {
+			p = NewPromise()
+			p.Resolve(value)
+		}
+		p.onSettled(func() {
+			if p.state == rejected {
+				res.Reject(p.value)
+				return
+			}
+			results[idx] = p.value
+			remaining--
+			if remaining == 0 {
+				res.Resolve(&Array{Elems: results})
+			}
+		})
+	}
+	return res, nil
+}
+
+func (e *Evaluator) promiseMethod(p *Promise, name string) (interface{}, error) {
+	switch name {
+	case "then":
+		return func(args ...interface{}) (interface{}, error) {
+			var onFulfilled, onRejected interface{}
+			if len(args) > 0 {
+				onFulfilled = args[0]
+			}
+			if len(args) > 1 {
+				onRejected = args[1]
+			}
+			return p.Then(onFulfilled, onRejected), nil
+		}, nil
+	case "catch":
+		return func(onRejected interface{}) (interface{}, error) {
+			return p.Then(nil, onRejected), nil
+		}, nil
+	}
+	return nil, NotImplementedError{
+		Message: fmt.Sprintf("promise method %q not implemented", name),
+		Item:    p,
+	}
+}
+
+func (e *Evaluator) EvalImportCall(expr *js.CallExpr) (interface{}, error) {
+	if len(expr.Args.List) != 1 {
+		return nil, WrongNumberOfArgsError{
+			Message: fmt.Sprintf("import() takes 1 arg, got %v", len(expr.Args.List)),
+			Item:    expr,
+			Got:     len(expr.Args.List),
+			Want:    1,
+		}
+	}
+	specifier, err := e.Eval(expr.Args.List[0].Value)
+	if err != nil {
+		return nil, err
+	}
+	res := NewPromise()
+	namespace, err := e.Runtime.importModule(fmt.Sprint(specifier), e.referrer())
+	if err != nil {
+		res.Reject(err)
+	} else {
+		res.Resolve(namespace)
+	}
+	return res, nil
+}
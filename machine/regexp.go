@@ -0,0 +1,315 @@
+package machine
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+type InvalidRegExpError struct {
+	Message string
+	Item    interface{}
+}
+
+func (i InvalidRegExpError) Error() string {
+	return i.Message
+}
+
+var namedGroupPattern = regexp.MustCompile(`\(\?<(\w+)>`)
+
+type RegExp struct {
+	Source    string
+	Flags     string
+	LastIndex int
+
+	re *regexp.Regexp
+}
+
+func NewRegExp(source, flags string) (*RegExp, error) {
+	prefix := ""
+	for _, flag := range flags {
+		switch flag {
+		case 'i', 'm', 's':
+			prefix += string(flag)
+		case 'g', 'y', 'u':
+		default:
+			return nil, InvalidRegExpError{
+				Message: fmt.Sprintf("invalid regular expression flag %q", flag),
+				Item:    flags,
+			}
+		}
+	}
+	// Go only understands the (?P<name>) form of named groups.
+	expr := namedGroupPattern.ReplaceAllString(source, "(?P<$1>")
+	if prefix != "" {
+		expr = "(?" + prefix + ")" + expr
+	}
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, InvalidRegExpError{
+			Message: fmt.Sprintf("invalid regular expression /%v/%v: %v", source, flags, err),
+			Item:    source,
+		}
+	}
+	return &RegExp{
+		Source: source,
+		Flags:  flags,
+		re:     re,
+	}, nil
+}
+
+// RegExpConstructor implements RegExp(source, flags), copying the source and flags of RegExp sources.
+func RegExpConstructor(r *Runtime, args ...interface{}) (interface{}, error) {
+	source, flags := "(?:)", ""
+	if len(args) > 0 {
+		if re, ok := args[0].(*RegExp); ok {
+			source, flags = re.Source, re.Flags
+		} else {
+			source = fmt.Sprint(args[0])
+		}
+	}
+	if len(args) > 1 && args[1] != nil {
+		flags = fmt.Sprint(args[1])
+	}
+	return NewRegExp(source, flags)
+}
+
+func ParseRegExpLiteral(literal string) (*RegExp, error) {
+	end := strings.LastIndex(literal, "/")
+	if !strings.HasPrefix(literal, "/") || end < 1 {
+		return nil, InvalidRegExpError{
+			Message: fmt.Sprintf("invalid regular expression literal %q", literal),
+			Item:    literal,
+		}
+	}
+	return NewRegExp(literal[1:end], literal[end+1:])
+}
+
+func (r *RegExp) Global() bool {
+	return strings.Contains(r.Flags, "g")
+}
+
+func (r *RegExp) String() string {
+	return "/" + r.Source + "/" + r.Flags
+}
+
+// matchArray builds a match result like JS, with the groups as elements and index, input and groups as properties.
+func (r *RegExp) matchArray(s string, loc []int) *Array {
+	res := make([]interface{}, len(loc)/2)
+	var groups *OrderedMap
+	for idx, name := range r.re.SubexpNames() {
+		var group interface{}
+		if loc[idx*2] >= 0 {
+			group = s[loc[idx*2]:loc[idx*2+1]]
+		}
+		res[idx] = group
+		if name != "" {
+			if groups == nil {
+				groups = NewOrderedMap()
+			}
+			groups.Set(name, group)
+		}
+	}
+	properties := map[string]interface{}{
+		"index":  len(utf16.Encode([]rune(s[:loc[0]]))),
+		"input":  s,
+		"groups": nil,
+	}
+	if groups != nil {
+		properties["groups"] = groups
+	}
+	return &Array{
+		Elems:      res,
+		Properties: properties,
+	}
+}
+
+func (r *RegExp) Exec(s string) interface{} {
+	start := 0
+	if r.Global() {
+		start = r.LastIndex
+		if start > len(s) {
+			r.LastIndex = 0
+			return nil
+		}
+	}
+	loc := r.re.FindStringSubmatchIndex(s[start:])
+	if loc == nil {
+		r.LastIndex = 0
+		return nil
+	}
+	for idx := range loc {
+		if loc[idx] >= 0 {
+			loc[idx] += start
+		}
+	}
+	if r.Global() {
+		r.LastIndex = loc[1]
+		if loc[0] == loc[1] {
+			r.LastIndex++
+		}
+	}
+	return r.matchArray(s, loc)
+}
+
+func (r *RegExp) Test(s string) bool {
+	return r.Exec(s) != nil
+}
+
+func (r *RegExp) Match(s string) interface{} {
+	if !r.Global() {
+		loc := r.re.FindStringSubmatchIndex(s)
+		if loc == nil {
+			return nil
+		}
+		return r.matchArray(s, loc)
+	}
+	matches := r.re.FindAllString(s, -1)
+	if matches == nil {
+		return nil
+	}
+	res := make([]interface{}, len(matches))
+	for idx := range matches {
+		res[idx] = matches[idx]
+	}
+	return &Array{Elems: res}
+}
+
+func expandReplacement(repl, s string, loc []int) string {
+	res := &strings.Builder{}
+	for idx := 0; idx < len(repl); idx++ {
+		if repl[idx] != '$' || idx+1 == len(repl) {
+			res.WriteByte(repl[idx])
+			continue
+		}
+		switch next := repl[idx+1]; {
+		case next == '$':
+			res.WriteByte('$')
+			idx++
+		case next == '&':
+			res.WriteString(s[loc[0]:loc[1]])
+			idx++
+		case next >= '0' && next <= '9':
+			group, width := int(next-'0'), 1
+			if idx+2 < len(repl) && repl[idx+2] >= '0' && repl[idx+2] <= '9' {
+				if two := group*10 + int(repl[idx+2]-'0'); two > 0 && two < len(loc)/2 {
+					group, width = two, 2
+				}
+			}
+			if group == 0 || group >= len(loc)/2 {
+				res.WriteByte('$')
+				continue
+			}
+			if loc[group*2] >= 0 {
+				res.WriteString(s[loc[group*2]:loc[group*2+1]])
+			}
+			idx += width
+		default:
+			res.WriteByte('$')
+		}
+	}
+	return res.String()
+}
+
+func (r *RegExp) locations(s string) [][]int {
+	if r.Global() {
+		return r.re.FindAllStringSubmatchIndex(s, -1)
+	}
+	if loc := r.re.FindStringSubmatchIndex(s); loc != nil {
+		return [][]int{loc}
+	}
+	return nil
+}
+
+func (r *RegExp) Replace(s, repl string) string {
+	res, _ := replaceLocations(s, r.locations(s), func(loc []int) (string, error) {
+		return expandReplacement(repl, s, loc), nil
+	})
+	return res
+}
+
+func replaceLocations(s string, locs [][]int, replacer func(loc []int) (string, error)) (string, error) {
+	res := &strings.Builder{}
+	last := 0
+	for _, loc := range locs {
+		replacement, err := replacer(loc)
+		if err != nil {
+			return "", err
+		}
+		res.WriteString(s[last:loc[0]])
+		res.WriteString(replacement)
+		last = loc[1]
+	}
+	res.WriteString(s[last:])
+	return res.String(), nil
+}
+
+// MatchAll searches for the next match each time the iterator is advanced.
+func (r *RegExp) MatchAll(s string) *Iterator {
+	start := 0
+	return NewIterator(func() (interface{}, bool) {
+		if start > len(s) {
+			return nil, true
+		}
+		loc := r.re.FindStringSubmatchIndex(s[start:])
+		if loc == nil {
+			start = len(s) + 1
+			return nil, true
+		}
+		for idx := range loc {
+			if loc[idx] >= 0 {
+				loc[idx] += start
+			}
+		}
+		start = loc[1]
+		if loc[0] == loc[1] {
+			// Step past empty matches, or they would be found again forever.
+			_, width := utf8.DecodeRuneInString(s[start:])
+			start += width
+			if width == 0 {
+				start++
+			}
+		}
+		return r.matchArray(s, loc), false
+	})
+}
+
+func (r *RegExp) Split(s string) *Array {
+	parts := r.re.Split(s, -1)
+	res := make([]interface{}, len(parts))
+	for idx := range parts {
+		res[idx] = parts[idx]
+	}
+	return &Array{Elems: res}
+}
+
+func toRegExp(i interface{}) (*RegExp, error) {
+	if re, ok := i.(*RegExp); ok {
+		return re, nil
+	}
+	return NewRegExp(ToJSString(i), "")
+}
+
+func (e *Evaluator) regExpProperty(r *RegExp, name string) (interface{}, error) {
+	switch name {
+	case "test":
+		return func(s string) (interface{}, error) {
+			return r.Test(s), nil
+		}, nil
+	case "exec":
+		return func(s string) (interface{}, error) {
+			return r.Exec(s), nil
+		}, nil
+	case "source":
+		return r.Source, nil
+	case "flags":
+		return r.Flags, nil
+	case "global":
+		return r.Global(), nil
+	case "lastIndex":
+		return r.LastIndex, nil
+	}
+	return nil, nil
+}
@@ -0,0 +1,323 @@
+package machine
+
+import (
+	"fmt"
+	"strconv"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+type InvalidArrayLengthError struct {
+	Message string
+	Item    interface{}
+}
+
+func (i InvalidArrayLengthError) Error() string {
+	return i.Message
+}
+
+func namespace(properties map[string]interface{}) *OrderedMap {
+	res := NewOrderedMap()
+	for _, name := range sortedKeys(properties) {
+		res.Set(name, properties[name])
+	}
+	return res
+}
+
+func InstallStdlib(m *M) {
+	// Namespaces are objects, so that each runtime gets its own copy to mutate.
+	m.Globals["Object"] = namespace(map[string]interface{}{
+		"assign":      RuntimeFunc(ObjectAssign),
+		"keys":        RuntimeFunc(ObjectKeys),
+		"values":      RuntimeFunc(ObjectValues),
+		"entries":     RuntimeFunc(ObjectEntries),
+		"fromEntries": RuntimeFunc(ObjectFromEntries),
+		"freeze": RuntimeFunc(func(r *Runtime, args ...interface{}) (interface{}, error) {
+			if len(args) == 0 {
+				return nil, nil
+			}
+			return r.Freeze(args[0]), nil
+		}),
+		"isFrozen": RuntimeFunc(func(r *Runtime, args ...interface{}) (interface{}, error) {
+			if len(args) == 0 {
+				return true, nil
+			}
+			return r.IsFrozen(args[0]), nil
+		}),
+	})
+	mathObject := map[string]interface{}{
+		"random": RuntimeFunc(func(r *Runtime, args ...interface{}) (interface{}, error) {
+			return r.Rand().Float64(), nil
+		}),
+	}
+	for name, value := range mathProperties {
+		mathObject[name] = value
+	}
+	m.Globals["Math"] = namespace(mathObject)
+	m.Globals["Date"] = &FuncObject{
+		Func: RuntimeFunc(NewDate),
+		Properties: map[string]interface{}{
+			"now": RuntimeFunc(func(r *Runtime, args ...interface{}) (interface{}, error) {
+				return millis(r.clock().Now()), nil
+			}),
+		},
+	}
+	m.Globals["Array"] = &FuncObject{
+		Func: RuntimeFunc(NewArray),
+		Properties: map[string]interface{}{
+			"isArray": func(i interface{}) (interface{}, error) {
+				return IsArray(i), nil
+			},
+			"from": RuntimeFunc(ArrayFrom),
+			"of": func(args ...interface{}) (interface{}, error) {
+				return &Array{Elems: append([]interface{}{}, args...)}, nil
+			},
+		},
+	}
+	m.Globals["Promise"] = &FuncObject{
+		Func: RuntimeFunc(PromiseConstructor),
+		Properties: map[string]interface{}{
+			"all":     PromiseAll,
+			"resolve": PromiseResolve,
+			"reject":  PromiseReject,
+		},
+	}
+	m.Globals["String"] = &FuncObject{
+		Func: func(args ...interface{}) (interface{}, error) {
+			if len(args) == 0 {
+				return "", nil
+			}
+			return ToJSString(args[0]), nil
+		},
+		Properties: map[string]interface{}{
+			"codePointCount": func(s string) (interface{}, error) {
+				return utf8.RuneCountInString(s), nil
+			},
+			"fromCharCode":  StringFromCharCode,
+			"fromCodePoint": StringFromCodePoint,
+		},
+	}
+	m.Globals["JSON"] = namespace(map[string]interface{}{
+		"parse":     RuntimeFunc(JSONParse),
+		"stringify": RuntimeFunc(JSONStringify),
+	})
+	m.Globals["structuredClone"] = RuntimeFunc(StructuredClone)
+	m.Globals["parseInt"] = ParseInt
+	m.Globals["parseFloat"] = ParseFloat
+	m.Globals["Symbol"] = NewSymbol
+	m.Globals["Set"] = RuntimeFunc(NewSet)
+	m.Globals["Map"] = RuntimeFunc(NewMap)
+	m.Globals["RegExp"] = RuntimeFunc(RegExpConstructor)
+	m.Globals["isType"] = func(i interface{}, name string) (interface{}, error) {
+		return m.IsType(i, name)
+	}
+}
+
+func eachOwnProperty(r *Runtime, args []interface{}, f func(key string, value interface{})) {
+	if len(args) == 0 {
+		return
+	}
+	switch v := args[0].(type) {
+	case *OrderedMap, map[string]interface{}:
+		obj, _ := asObject(v)
+		for _, key := range obj.Keys() {
+			value, _ := obj.Get(key)
+			f(key, value)
+		}
+	case *Array:
+		for idx := range v.Elems {
+			f(strconv.Itoa(idx), v.Elems[idx])
+		}
+	case string:
+		units := utf16.Encode([]rune(v))
+		for idx := range units {
+			f(strconv.Itoa(idx), string(utf16.Decode(units[idx:idx+1])))
+		}
+	}
+}
+
+func ObjectKeys(r *Runtime, args ...interface{}) (interface{}, error) {
+	res := &Array{Elems: []interface{}{}}
+	eachOwnProperty(r, args, func(key string, value interface{}) {
+		res.Elems = append(res.Elems, key)
+	})
+	return res, nil
+}
+
+func ObjectValues(r *Runtime, args ...interface{}) (interface{}, error) {
+	res := &Array{Elems: []interface{}{}}
+	eachOwnProperty(r, args, func(key string, value interface{}) {
+		res.Elems = append(res.Elems, value)
+	})
+	return res, nil
+}
+
+func ObjectEntries(r *Runtime, args ...interface{}) (interface{}, error) {
+	res := &Array{Elems: []interface{}{}}
+	eachOwnProperty(r, args, func(key string, value interface{}) {
+		res.Elems = append(res.Elems, &Array{Elems: []interface{}{key, value}})
+	})
+	return res, nil
+}
+
+func ObjectFromEntries(r *Runtime, args ...interface{}) (interface{}, error) {
+	res := NewOrderedMap()
+	if len(args) == 0 {
+		return nil, NotIterableError{
+			Message: "Object.fromEntries needs an iterable of entries",
+			Item:    args,
+		}
+	}
+	if err := iterate(args[0], func(entry interface{}) error {
+		pair, ok := entry.(*Array)
+		if !ok || len(pair.Elems) < 2 {
+			return NotPairError{
+				Message: fmt.Sprintf("%#v isn't a pair of two values", entry),
+				Item:    entry,
+			}
+		}
+		if err := r.ThrottleAllocation(pair.Elems[1]); err != nil {
+			return err
+		}
+		res.Set(ToJSString(pair.Elems[0]), pair.Elems[1])
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// MaxArrayLength is the largest length JS allows for arrays.
+const MaxArrayLength = 1<<32 - 1
+
+// allowArrayLength throttles before allocating, since a huge allocation can't be recovered from.
+func (r *Runtime) allowArrayLength(n int) error {
+	if err := r.ThrottleAllocation(ArrayGrowth{Length: n}); err != nil {
+		return err
+	}
+	if int64(n) > MaxArrayLength {
+		return InvalidArrayLengthError{
+			Message: fmt.Sprintf("invalid array length %v", n),
+			Item:    n,
+		}
+	}
+	return nil
+}
+
+func NewArray(r *Runtime, args ...interface{}) (interface{}, error) {
+	if len(args) == 1 {
+		switch n := args[0].(type) {
+		case int:
+			if n < 0 {
+				return nil, InvalidArrayLengthError{
+					Message: fmt.Sprintf("invalid array length %v", n),
+					Item:    n,
+				}
+			}
+			if err := r.allowArrayLength(n); err != nil {
+				return nil, err
+			}
+			return &Array{Elems: make([]interface{}, n)}, nil
+		case float64:
+			return nil, InvalidArrayLengthError{
+				Message: fmt.Sprintf("invalid array length %v", n),
+				Item:    n,
+			}
+		}
+	}
+	res := &Array{Elems: append([]interface{}{}, args...)}
+	if err := r.ThrottleAllocation(res); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+func ArrayFrom(r *Runtime, args ...interface{}) (interface{}, error) {
+	if len(args) == 0 {
+		return nil, WrongNumberOfArgsError{
+			Message: "Array.from takes at least 1 arg, got 0",
+			Item:    args,
+			Got:     0,
+			Want:    1,
+		}
+	}
+	res := &Array{Elems: []interface{}{}}
+	add := func(el interface{}) error {
+		if len(args) > 1 && args[1] != nil {
+			var err error
+			if el, err = r.call(args[1], []interface{}{el, len(res.Elems)}); err != nil {
+				return err
+			}
+		}
+		res.Elems = append(res.Elems, el)
+		return nil
+	}
+	if obj, ok := asObject(args[0]); ok {
+		length, _ := obj.Get("length")
+		n, err := intArg([]interface{}{length}, 0, 0)
+		if err != nil {
+			return nil, err
+		}
+		if err := r.allowArrayLength(n); err != nil {
+			return nil, err
+		}
+		for idx := 0; idx < n; idx++ {
+			el, _ := obj.Get(strconv.Itoa(idx))
+			if err := add(el); err != nil {
+				return nil, err
+			}
+		}
+	} else if err := iterate(args[0], add); err != nil {
+		return nil, err
+	}
+	if err := r.ThrottleAllocation(res); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+func IsArray(i interface{}) bool {
+	switch i.(type) {
+	case *Array, []interface{}:
+		return true
+	}
+	return false
+}
+
+func ObjectAssign(r *Runtime, args ...interface{}) (interface{}, error) {
+	if len(args) == 0 {
+		return nil, WrongNumberOfArgsError{
+			Message: "Object.assign takes at least 1 arg, got 0",
+			Item:    args,
+			Got:     0,
+			Want:    1,
+		}
+	}
+	target, ok := asObject(args[0])
+	if !ok {
+		return nil, NotObjectError{
+			Message: fmt.Sprintf("%#v is not an object", args[0]),
+			Item:    args[0],
+		}
+	}
+	if err := r.checkNotFrozen(args[0]); err != nil {
+		return nil, err
+	}
+	for _, iSource := range args[1:] {
+		if iSource == nil {
+			continue
+		}
+		source, ok := asObject(iSource)
+		if !ok {
+			return nil, NotObjectError{
+				Message: fmt.Sprintf("%#v is not an object", iSource),
+				Item:    iSource,
+			}
+		}
+		for _, key := range source.Keys() {
+			value, _ := source.Get(key)
+			target.Set(key, value)
+		}
+	}
+	return args[0], nil
+}
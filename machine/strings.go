@@ -0,0 +1,530 @@
+package machine
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+type InvalidCountError struct {
+	Message string
+	Item    interface{}
+}
+
+func (i InvalidCountError) Error() string {
+	return i.Message
+}
+
+type InvalidCodePointError struct {
+	Message string
+	Item    interface{}
+}
+
+func (i InvalidCodePointError) Error() string {
+	return i.Message
+}
+
+func StringFromCharCode(args ...interface{}) (interface{}, error) {
+	units := make([]uint16, len(args))
+	for idx, arg := range args {
+		f := toFloat(arg)
+		if math.IsNaN(f) || math.IsInf(f, 0) {
+			continue
+		}
+		units[idx] = uint16(int64(f))
+	}
+	return string(utf16.Decode(units)), nil
+}
+
+func StringFromCodePoint(args ...interface{}) (interface{}, error) {
+	units := []uint16{}
+	for _, arg := range args {
+		f := toFloat(arg)
+		if f != math.Trunc(f) || f < 0 || f > unicode.MaxRune {
+			return nil, InvalidCodePointError{
+				Message: fmt.Sprintf("invalid code point %v", ToJSString(arg)),
+				Item:    arg,
+			}
+		}
+		if r1, r2 := utf16.EncodeRune(rune(f)); r1 != unicode.ReplacementChar {
+			units = append(units, uint16(r1), uint16(r2))
+		} else {
+			units = append(units, uint16(f))
+		}
+	}
+	return string(utf16.Decode(units)), nil
+}
+
+func StringLength(s string) int {
+	res := 0
+	for _, r := range s {
+		if r1, _ := utf16.EncodeRune(r); r1 == unicode.ReplacementChar {
+			res++
+		} else {
+			res += 2
+		}
+	}
+	return res
+}
+
+// ToJSString converts values to strings the way JS String(x) does.
+func ToJSString(i interface{}) string {
+	switch v := i.(type) {
+	case nil:
+		return "null"
+	case string:
+		return v
+	case bool:
+		return strconv.FormatBool(v)
+	case int, float64:
+		return FormatNumber(v)
+	case *Array:
+		return Join(v.Elems, ",")
+	case []interface{}:
+		return Join(v, ",")
+	case *OrderedMap, map[string]interface{}:
+		obj, _ := asObject(v)
+		if toString, found := obj.Get("toString"); found {
+			if res, err := Call(toString, nil); err == nil {
+				return ToJSString(res)
+			}
+		}
+		return "[object Object]"
+	case *Date:
+		return v.Time.UTC().Format("2006-01-02T15:04:05.000Z")
+	case *Set:
+		return "[object Set]"
+	case *Map:
+		return "[object Map]"
+	case *Promise:
+		return "[object Promise]"
+	case *FuncObject:
+		return "function () { [native code] }"
+	}
+	if reflect.ValueOf(i).Kind() == reflect.Func {
+		return "function () { [native code] }"
+	}
+	return fmt.Sprint(i)
+}
+
+// JS counts the BOM as whitespace but not NEL, unlike unicode.IsSpace.
+func isJSWhitespace(r rune) bool {
+	return r == '\uFEFF' || (unicode.IsSpace(r) && r != '\u0085')
+}
+
+func clamp(n, min, max int) int {
+	if n < min {
+		return min
+	}
+	if n > max {
+		return max
+	}
+	return n
+}
+
+func searchUnits(args []interface{}) []uint16 {
+	var search interface{}
+	if len(args) > 0 {
+		search = args[0]
+	}
+	return utf16.Encode([]rune(ToJSString(search)))
+}
+
+func hasUnitsAt(units, search []uint16, at int) bool {
+	if at < 0 || at+len(search) > len(units) {
+		return false
+	}
+	for idx := range search {
+		if units[at+idx] != search[idx] {
+			return false
+		}
+	}
+	return true
+}
+
+// indexUnits works on UTF-16 code units so that the result is a JS string index.
+func indexUnits(units, search []uint16, from int) int {
+	for at := from; at+len(search) <= len(units); at++ {
+		if hasUnitsAt(units, search, at) {
+			return at
+		}
+	}
+	return -1
+}
+
+const maxInt = int(^uint(0) >> 1)
+
+// repeatLength checks the count before multiplying, so that huge counts can't overflow into small lengths.
+func repeatLength(s string, count int) (int, error) {
+	if count < 0 {
+		return 0, InvalidCountError{
+			Message: fmt.Sprintf("invalid count %v for repeat of %q", count, s),
+			Item:    count,
+		}
+	}
+	if len(s) > 0 && count > maxInt/len(s) {
+		return 0, InvalidCountError{
+			Message: fmt.Sprintf("count %v for repeat of %q is too large", count, s),
+			Item:    count,
+		}
+	}
+	return len(s) * count, nil
+}
+
+func repeatString(s string, count int) (string, error) {
+	if _, err := repeatLength(s, count); err != nil {
+		return "", err
+	}
+	return strings.Repeat(s, count), nil
+}
+
+func (r *Runtime) throttleRepeat(s string, count int) error {
+	length, err := repeatLength(s, count)
+	if err != nil || length == 0 {
+		return err
+	}
+	return r.ThrottleAllocation(StringGrowth{String: s, Length: length})
+}
+
+func (e *Evaluator) pad(v string, args []interface{}, atStart bool) (interface{}, error) {
+	units := utf16.Encode([]rune(v))
+	target, err := intArg(args, 0, 0)
+	if err != nil {
+		return nil, err
+	}
+	padding := " "
+	if len(args) > 1 && args[1] != nil {
+		padding = ToJSString(args[1])
+	}
+	padUnits := utf16.Encode([]rune(padding))
+	if target <= len(units) || len(padUnits) == 0 {
+		return v, nil
+	}
+	fill := target - len(units)
+	if err := e.Runtime.ThrottleAllocation(StringGrowth{String: v, Length: len(v) + fill*utf8.UTFMax}); err != nil {
+		return nil, err
+	}
+	filler := make([]uint16, 0, fill+len(padUnits))
+	for len(filler) < fill {
+		filler = append(filler, padUnits...)
+	}
+	filler = filler[:fill]
+	if atStart {
+		return string(utf16.Decode(append(filler, units...))), nil
+	}
+	return string(utf16.Decode(append(units, filler...))), nil
+}
+
+// stringLocations finds non overlapping occurrences, and an empty search matches between every character.
+func stringLocations(s, search string, all bool) [][]int {
+	res := [][]int{}
+	for from := 0; from <= len(s); {
+		idx := strings.Index(s[from:], search)
+		if idx == -1 {
+			break
+		}
+		start := from + idx
+		res = append(res, []int{start, start + len(search)})
+		if !all {
+			break
+		}
+		from = start + len(search)
+		if search == "" {
+			if start == len(s) {
+				break
+			}
+			_, width := utf8.DecodeRuneInString(s[start:])
+			from += width
+		}
+	}
+	return res
+}
+
+func (e *Evaluator) replace(v string, args []interface{}, all bool) (interface{}, error) {
+	var pattern, replacement interface{}
+	if len(args) > 0 {
+		pattern = args[0]
+	}
+	if len(args) > 1 {
+		replacement = args[1]
+	}
+	var locs [][]int
+	if re, ok := pattern.(*RegExp); ok {
+		if all && !re.Global() {
+			return nil, InvalidRegExpError{
+				Message: fmt.Sprintf("replaceAll requires a global RegExp, got %v", re),
+				Item:    re,
+			}
+		}
+		locs = re.locations(v)
+	} else {
+		locs = stringLocations(v, ToJSString(pattern), all)
+	}
+	if !isCallable(replacement) {
+		repl := ToJSString(replacement)
+		return replaceLocations(v, locs, func(loc []int) (string, error) {
+			return expandReplacement(repl, v, loc), nil
+		})
+	}
+	return replaceLocations(v, locs, func(loc []int) (string, error) {
+		callArgs := []interface{}{}
+		for group := 0; group < len(loc)/2; group++ {
+			if loc[group*2] < 0 {
+				callArgs = append(callArgs, nil)
+			} else {
+				callArgs = append(callArgs, v[loc[group*2]:loc[group*2+1]])
+			}
+		}
+		callArgs = append(callArgs, StringLength(v[:loc[0]]), v)
+		res, err := e.Runtime.call(replacement, callArgs)
+		if err != nil {
+			return "", err
+		}
+		return ToJSString(res), nil
+	})
+}
+
+var stringProperties = map[string]func(e *Evaluator, v string) (interface{}, error){
+	"length": func(e *Evaluator, v string) (interface{}, error) {
+		return StringLength(v), nil
+	},
+	"at": func(e *Evaluator, v string) (interface{}, error) {
+		return func(args ...interface{}) (interface{}, error) {
+			idx, err := intArg(args, 0, 0)
+			if err != nil {
+				return nil, err
+			}
+			units := utf16.Encode([]rune(v))
+			if idx, ok := absoluteIndex(idx, len(units)); ok {
+				return string(utf16.Decode(units[idx : idx+1])), nil
+			}
+			return nil, nil
+		}, nil
+	},
+	"charCodeAt": func(e *Evaluator, v string) (interface{}, error) {
+		return func(args ...interface{}) (interface{}, error) {
+			idx, err := intArg(args, 0, 0)
+			if err != nil {
+				return nil, err
+			}
+			units := utf16.Encode([]rune(v))
+			if idx < 0 || idx >= len(units) {
+				return math.NaN(), nil
+			}
+			return int(units[idx]), nil
+		}, nil
+	},
+	"codePointAt": func(e *Evaluator, v string) (interface{}, error) {
+		return func(args ...interface{}) (interface{}, error) {
+			idx, err := intArg(args, 0, 0)
+			if err != nil {
+				return nil, err
+			}
+			units := utf16.Encode([]rune(v))
+			if idx < 0 || idx >= len(units) {
+				return nil, nil
+			}
+			if idx+1 < len(units) && utf16.IsSurrogate(rune(units[idx])) {
+				if r := utf16.DecodeRune(rune(units[idx]), rune(units[idx+1])); r != unicode.ReplacementChar {
+					return int(r), nil
+				}
+			}
+			return int(units[idx]), nil
+		}, nil
+	},
+	"toUpperCase": func(e *Evaluator, v string) (interface{}, error) {
+		return func(...interface{}) (interface{}, error) {
+			return toUpperCase(v), nil
+		}, nil
+	},
+	"toLowerCase": func(e *Evaluator, v string) (interface{}, error) {
+		return func(...interface{}) (interface{}, error) {
+			return toLowerCase(v), nil
+		}, nil
+	},
+	"trim": func(e *Evaluator, v string) (interface{}, error) {
+		return func(...interface{}) (interface{}, error) {
+			return strings.TrimFunc(v, isJSWhitespace), nil
+		}, nil
+	},
+	"trimStart": func(e *Evaluator, v string) (interface{}, error) {
+		return func(...interface{}) (interface{}, error) {
+			return strings.TrimLeftFunc(v, isJSWhitespace), nil
+		}, nil
+	},
+	"trimEnd": func(e *Evaluator, v string) (interface{}, error) {
+		return func(...interface{}) (interface{}, error) {
+			return strings.TrimRightFunc(v, isJSWhitespace), nil
+		}, nil
+	},
+	"indexOf": func(e *Evaluator, v string) (interface{}, error) {
+		return func(args ...interface{}) (interface{}, error) {
+			units := utf16.Encode([]rune(v))
+			from, err := intArg(args, 1, 0)
+			if err != nil {
+				return nil, err
+			}
+			return indexUnits(units, searchUnits(args), clamp(from, 0, len(units))), nil
+		}, nil
+	},
+	"includes": func(e *Evaluator, v string) (interface{}, error) {
+		return func(args ...interface{}) (interface{}, error) {
+			units := utf16.Encode([]rune(v))
+			from, err := intArg(args, 1, 0)
+			if err != nil {
+				return nil, err
+			}
+			return indexUnits(units, searchUnits(args), clamp(from, 0, len(units))) != -1, nil
+		}, nil
+	},
+	"startsWith": func(e *Evaluator, v string) (interface{}, error) {
+		return func(args ...interface{}) (interface{}, error) {
+			units := utf16.Encode([]rune(v))
+			from, err := intArg(args, 1, 0)
+			if err != nil {
+				return nil, err
+			}
+			from = clamp(from, 0, len(units))
+			return hasUnitsAt(units, searchUnits(args), from), nil
+		}, nil
+	},
+	"endsWith": func(e *Evaluator, v string) (interface{}, error) {
+		return func(args ...interface{}) (interface{}, error) {
+			units := utf16.Encode([]rune(v))
+			end, err := intArg(args, 1, len(units))
+			if err != nil {
+				return nil, err
+			}
+			end = clamp(end, 0, len(units))
+			search := searchUnits(args)
+			return hasUnitsAt(units, search, end-len(search)), nil
+		}, nil
+	},
+	"slice": func(e *Evaluator, v string) (interface{}, error) {
+		return func(args ...interface{}) (interface{}, error) {
+			units := utf16.Encode([]rune(v))
+			start, end, err := sliceBounds(args, len(units))
+			if err != nil {
+				return nil, err
+			}
+			return string(utf16.Decode(units[start:end])), nil
+		}, nil
+	},
+	"substring": func(e *Evaluator, v string) (interface{}, error) {
+		return func(args ...interface{}) (interface{}, error) {
+			units := utf16.Encode([]rune(v))
+			start, err := intArg(args, 0, 0)
+			if err != nil {
+				return nil, err
+			}
+			end, err := intArg(args, 1, len(units))
+			if err != nil {
+				return nil, err
+			}
+			start, end = clamp(start, 0, len(units)), clamp(end, 0, len(units))
+			if start > end {
+				start, end = end, start
+			}
+			return string(utf16.Decode(units[start:end])), nil
+		}, nil
+	},
+	"localeCompare": func(e *Evaluator, v string) (interface{}, error) {
+		return func(args ...interface{}) (interface{}, error) {
+			var other interface{}
+			if len(args) > 0 {
+				other = args[0]
+			}
+			if collator := e.Runtime.M.Collator; collator != nil {
+				return collator(v, ToJSString(other)), nil
+			}
+			return strings.Compare(v, ToJSString(other)), nil
+		}, nil
+	},
+	"match": func(e *Evaluator, v string) (interface{}, error) {
+		return func(pattern interface{}) (interface{}, error) {
+			re, err := toRegExp(pattern)
+			if err != nil {
+				return nil, err
+			}
+			return re.Match(v), nil
+		}, nil
+	},
+	"matchAll": func(e *Evaluator, v string) (interface{}, error) {
+		return func(pattern interface{}) (interface{}, error) {
+			re, ok := pattern.(*RegExp)
+			if !ok {
+				var err error
+				if re, err = NewRegExp(ToJSString(pattern), "g"); err != nil {
+					return nil, err
+				}
+			}
+			if !re.Global() {
+				return nil, InvalidRegExpError{
+					Message: fmt.Sprintf("matchAll requires a global RegExp, got %v", re),
+					Item:    re,
+				}
+			}
+			return re.MatchAll(v), nil
+		}, nil
+	},
+	"replace": func(e *Evaluator, v string) (interface{}, error) {
+		return func(args ...interface{}) (interface{}, error) {
+			return e.replace(v, args, false)
+		}, nil
+	},
+	"replaceAll": func(e *Evaluator, v string) (interface{}, error) {
+		return func(args ...interface{}) (interface{}, error) {
+			return e.replace(v, args, true)
+		}, nil
+	},
+	"repeat": func(e *Evaluator, v string) (interface{}, error) {
+		return func(args ...interface{}) (interface{}, error) {
+			count, err := intArg(args, 0, 0)
+			if err != nil {
+				return nil, err
+			}
+			if err := e.Runtime.throttleRepeat(v, count); err != nil {
+				return nil, err
+			}
+			return repeatString(v, count)
+		}, nil
+	},
+	"padStart": func(e *Evaluator, v string) (interface{}, error) {
+		return func(args ...interface{}) (interface{}, error) {
+			return e.pad(v, args, true)
+		}, nil
+	},
+	"padEnd": func(e *Evaluator, v string) (interface{}, error) {
+		return func(args ...interface{}) (interface{}, error) {
+			return e.pad(v, args, false)
+		}, nil
+	},
+	"split": func(e *Evaluator, v string) (interface{}, error) {
+		return func(args ...interface{}) (interface{}, error) {
+			if len(args) == 0 || args[0] == nil {
+				return &Array{Elems: []interface{}{v}}, nil
+			}
+			if re, ok := args[0].(*RegExp); ok {
+				return re.Split(v), nil
+			}
+			parts := strings.Split(v, ToJSString(args[0]))
+			res := make([]interface{}, len(parts))
+			for idx := range parts {
+				res[idx] = parts[idx]
+			}
+			return &Array{Elems: res}, nil
+		}, nil
+	},
+}
+
+func init() {
+	stringProperties["toLocaleUpperCase"] = stringProperties["toUpperCase"]
+	stringProperties["toLocaleLowerCase"] = stringProperties["toLowerCase"]
+	stringProperties["trimLeft"] = stringProperties["trimStart"]
+	stringProperties["trimRight"] = stringProperties["trimEnd"]
+}
@@ -0,0 +1,43 @@
+package machine
+
+import (
+	"fmt"
+	"strings"
+	"sync/atomic"
+)
+
+// symbolKeyPrefix can't come out of a script string literal, so symbol keys never collide with string keys.
+const symbolKeyPrefix = "\x00symbol:"
+
+var nextSymbolID uint64
+
+type Symbol struct {
+	Description string
+
+	key string
+}
+
+func NewSymbol(args ...interface{}) (interface{}, error) {
+	res := &Symbol{
+		key: fmt.Sprintf("%s%d", symbolKeyPrefix, atomic.AddUint64(&nextSymbolID, 1)),
+	}
+	if len(args) > 0 && args[0] != nil {
+		res.Description = ToJSString(args[0])
+	}
+	return res, nil
+}
+
+func (s *Symbol) String() string {
+	return "Symbol(" + s.Description + ")"
+}
+
+func isSymbolKey(key string) bool {
+	return strings.HasPrefix(key, symbolKeyPrefix)
+}
+
+func propertyKey(i interface{}) string {
+	if sym, ok := i.(*Symbol); ok {
+		return sym.key
+	}
+	return fmt.Sprint(i)
+}
@@ -0,0 +1,208 @@
+package machine
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+type RuntimeClosedError struct {
+	Message string
+	Item    interface{}
+}
+
+func (r RuntimeClosedError) Error() string {
+	return r.Message
+}
+
+type Clock interface {
+	Now() time.Time
+	Sleep(ctx context.Context, d time.Duration) error
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+func (realClock) Sleep(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
+
+// minInterval is how often intervals fire at most, like in browsers, so that an interval without delay can't starve the other timers.
+const minInterval = 4 * time.Millisecond
+
+type timer struct {
+	id       int
+	due      time.Time
+	interval time.Duration
+	repeat   bool
+	callback interface{}
+	args     []interface{}
+}
+
+func (r *Runtime) clock() Clock {
+	if r.Clock == nil {
+		return realClock{}
+	}
+	return r.Clock
+}
+
+func (r *Runtime) installTimers() {
+	r.Globals["setTimeout"] = func(args ...interface{}) (interface{}, error) {
+		return r.addTimer(args, false)
+	}
+	r.Globals["setInterval"] = func(args ...interface{}) (interface{}, error) {
+		return r.addTimer(args, true)
+	}
+	r.Globals["clearTimeout"] = func(args ...interface{}) (interface{}, error) {
+		r.clearTimer(args)
+		return nil, nil
+	}
+	r.Globals["clearInterval"] = r.Globals["clearTimeout"]
+}
+
+func (r *Runtime) addTimer(args []interface{}, repeat bool) (interface{}, error) {
+	if r.closed {
+		return nil, RuntimeClosedError{
+			Message: "can't schedule timers on a closed runtime",
+			Item:    r,
+		}
+	}
+	if len(args) == 0 {
+		return nil, WrongNumberOfArgsError{
+			Message: "timers take at least 1 arg, got 0",
+			Item:    args,
+			Got:     0,
+			Want:    1,
+		}
+	}
+	t := &timer{
+		repeat:   repeat,
+		callback: args[0],
+	}
+	if len(args) > 1 {
+		switch ms := args[1].(type) {
+		case int:
+			t.interval = time.Duration(ms) * time.Millisecond
+		case float64:
+			t.interval = time.Duration(ms * float64(time.Millisecond))
+		case nil:
+		default:
+			return nil, NotImplementedError{
+				Message: fmt.Sprintf("timer delay %#v not implemented", args[1]),
+				Item:    args[1],
+			}
+		}
+		if t.interval < 0 {
+			t.interval = 0
+		}
+	}
+	if repeat && t.interval < minInterval {
+		t.interval = minInterval
+	}
+	if len(args) > 2 {
+		t.args = args[2:]
+	}
+	if err := r.ThrottleAllocation(t); err != nil {
+		return nil, err
+	}
+	r.nextTimerID++
+	t.id = r.nextTimerID
+	t.due = r.clock().Now().Add(t.interval)
+	if r.timers == nil {
+		r.timers = map[int]*timer{}
+	}
+	r.timers[t.id] = t
+	return t.id, nil
+}
+
+func (r *Runtime) clearTimer(args []interface{}) {
+	if len(args) == 0 {
+		return
+	}
+	if id, ok := args[0].(int); ok {
+		delete(r.timers, id)
+	}
+}
+
+func (r *Runtime) PendingTimers() int {
+	return len(r.timers)
+}
+
+func (r *Runtime) nextTimer() *timer {
+	var res *timer
+	for _, t := range r.timers {
+		if res == nil || t.due.Before(res.due) || (t.due.Equal(res.due) && t.id < res.id) {
+			res = t
+		}
+	}
+	return res
+}
+
+func (r *Runtime) RunLoop(ctx context.Context) (err error) {
+	defer recoverInternalError(&err)
+	return r.runUntil(ctx, nil)
+}
+
+func (r *Runtime) runUntil(ctx context.Context, done func() bool) error {
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		r.runCompletions()
+		if done != nil && done() {
+			return nil
+		}
+		t := r.nextTimer()
+		if t == nil {
+			if r.pendingTasks == 0 {
+				if done != nil {
+					return UnsettledPromiseError{
+						Message: "awaited promise can never settle",
+						Item:    r,
+					}
+				}
+				return nil
+			}
+			if err := r.waitForCompletion(ctx); err != nil {
+				return err
+			}
+			continue
+		}
+		if wait := t.due.Sub(r.clock().Now()); wait > 0 {
+			woken, err := r.sleep(ctx, wait)
+			if err != nil {
+				return err
+			}
+			if woken {
+				continue
+			}
+		}
+		if _, found := r.timers[t.id]; !found {
+			continue
+		}
+		if t.repeat {
+			t.due = t.due.Add(t.interval)
+		} else {
+			delete(r.timers, t.id)
+		}
+		if _, err := r.call(t.callback, t.args); err != nil {
+			return err
+		}
+	}
+}
+
+func (r *Runtime) Close() {
+	r.closed = true
+	r.timers = nil
+	r.stopGenerators()
+}
@@ -0,0 +1,37 @@
+package machine
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/tdewolff/parse/v2/js"
+	"github.com/zond/gojuice/scope"
+)
+
+type Tracer interface {
+	OnEval(node interface{}, depth int)
+}
+
+type StepFunc func(stmt js.IStmt, s *scope.S) error
+
+type WriterTracer struct {
+	Writer io.Writer
+}
+
+func (w WriterTracer) OnEval(node interface{}, depth int) {
+	fmt.Fprintf(w.Writer, "%vEval(%#v)\n", strings.Repeat("  ", depth), node)
+}
+
+func (r *Runtime) tracer() Tracer {
+	switch {
+	case r.Tracer != nil:
+		return r.Tracer
+	case r.M.Tracer != nil:
+		return r.M.Tracer
+	case r.Debug || r.M.Debug:
+		return WriterTracer{Writer: os.Stdout}
+	}
+	return nil
+}
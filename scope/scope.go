@@ -1,6 +1,9 @@
 package scope
 
-import "fmt"
+import (
+	"fmt"
+	"sort"
+)
 
 type Binding struct {
 	Item     interface{}
@@ -43,3 +46,39 @@ func (s *S) Set(name string, binding *Binding) error {
 func (s *S) Get(name string) *Binding {
 	return s.bindings[name]
 }
+
+func (s *S) Lookup(name string) *Binding {
+	for scope := s; scope != nil; scope = scope.Parent {
+		if binding := scope.Get(name); binding != nil {
+			return binding
+		}
+	}
+	return nil
+}
+
+func (s *S) Names() []string {
+	res := make([]string, 0, len(s.bindings))
+	for name := range s.bindings {
+		res = append(res, name)
+	}
+	sort.Strings(res)
+	return res
+}
+
+func (s *S) Each(f func(name string, b *Binding)) {
+	for _, name := range s.Names() {
+		f(name, s.bindings[name])
+	}
+}
+
+func (s *S) Visible() map[string]interface{} {
+	res := map[string]interface{}{}
+	for scope := s; scope != nil; scope = scope.Parent {
+		scope.Each(func(name string, b *Binding) {
+			if _, found := res[name]; !found {
+				res[name] = b.Item
+			}
+		})
+	}
+	return res
+}